@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/filer/internal/mimetype"
+	"github.com/user/filer/internal/models"
+)
+
+// fileColumn is a column that file listings can show
+type fileColumn struct {
+	name   string
+	header string
+	width  int
+	
+	// text is what the table format shows, value what the tabular formats
+	// (csv, tsv, markdown, html) write; text defaults to value
+	text  func(file *models.FileInfo) string
+	value func(file *models.FileInfo) string
+}
+
+func (c *fileColumn) display(file *models.FileInfo) string {
+	if c.text != nil {
+		return c.text(file)
+	}
+	return c.value(file)
+}
+
+// fileColumns are the columns selectable with --columns
+var fileColumns = []*fileColumn{
+	{name: "name", header: "NAME", width: 30, value: func(file *models.FileInfo) string { return file.Name }},
+	{name: "path", header: "PATH", width: 50, value: func(file *models.FileInfo) string { return file.Path }},
+	{name: "size", header: "SIZE", width: 12,
+		text:  func(file *models.FileInfo) string { return file.SizeHuman },
+		value: func(file *models.FileInfo) string { return int64toa(file.Size) }},
+	{name: "size_human", header: "SIZE", width: 12, value: func(file *models.FileInfo) string { return file.SizeHuman }},
+	{name: "modified", header: "MODIFIED", width: 20, value: func(file *models.FileInfo) string {
+		return file.ModTime.Format("2006-01-02 15:04:05")
+	}},
+	{name: "age", header: "AGE", width: 16, value: func(file *models.FileInfo) string { return relativeTime(file.ModTime) }},
+	{name: "mode", header: "MODE", width: 10,
+		text:  displayMode,
+		value: func(file *models.FileInfo) string { return file.Mode }},
+	{name: "type", header: "TYPE", width: 5, value: func(file *models.FileInfo) string {
+		if file.IsDir {
+			return "dir"
+		}
+		return "file"
+	}},
+	{name: "is_dir", header: "DIR", width: 5, value: func(file *models.FileInfo) string { return btoa(file.IsDir) }},
+	{name: "extension", header: "EXT", width: 10, value: func(file *models.FileInfo) string { return file.Extension }},
+	{name: "mime_type", header: "MIME", width: 28, value: func(file *models.FileInfo) string { return file.MimeType }},
+	{name: "hidden", header: "HIDDEN", width: 6, value: func(file *models.FileInfo) string { return btoa(file.Hidden) }},
+	{name: "matches", header: "MATCHES", width: 7, value: func(file *models.FileInfo) string { return itoa(file.MatchCount) }},
+}
+
+// columnAliases are shorter names accepted by --columns
+var columnAliases = map[string]string{
+	"ext":   "extension",
+	"mime":  "mime_type",
+	"mtime": "modified",
+	"dir":   "is_dir",
+}
+
+// lookupColumns resolves a list of column names, as given to --columns
+func lookupColumns(names ...string) ([]*fileColumn, error) {
+	var columns []*fileColumn
+	
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		
+		var found *fileColumn
+		for _, column := range fileColumns {
+			if column.name == name {
+				found = column
+				break
+			}
+		}
+		if found == nil {
+			valid := make([]string, len(fileColumns))
+			for i, column := range fileColumns {
+				valid[i] = column.name
+			}
+			return nil, fmt.Errorf("unknown column %q (expected one of: %s)", name, strings.Join(valid, ", "))
+		}
+		columns = append(columns, found)
+	}
+	
+	return columns, nil
+}
+
+// mustColumns resolves built-in column lists
+func mustColumns(names ...string) []*fileColumn {
+	columns, err := lookupColumns(names...)
+	if err != nil {
+		panic(err)
+	}
+	return columns
+}
+
+// fileOutput holds how file listings are printed: the columns chosen with
+// --columns (nil for the defaults) or a --template, and the --sort order
+// that the tree format applies within each directory
+type fileOutput struct {
+	columns  []*fileColumn
+	template *template.Template
+	sortBy   string
+	reverse  bool
+}
+
+// hasColumn reports whether a column was chosen with --columns
+func (o *fileOutput) hasColumn(name string) bool {
+	for _, column := range o.columns {
+		if column.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addOutputFlags adds the --columns and --template flags to a listing command
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().String("columns", "", "comma-separated columns for table and tabular formats, e.g. name,size,modified,path")
+	cmd.Flags().String("template", "", "print each file with a Go template, e.g. '{{.Path}}\\t{{human .Size}}'")
+}
+
+// getFileOutput parses the --columns and --template flags of a command
+// listing files found under dir
+func getFileOutput(cmd *cobra.Command, dir string) (*fileOutput, error) {
+	out := &fileOutput{}
+	out.sortBy, _ = cmd.Flags().GetString("sort")
+	out.reverse, _ = cmd.Flags().GetBool("reverse")
+	
+	if names, _ := cmd.Flags().GetString("columns"); names != "" {
+		columns, err := lookupColumns(strings.Split(names, ",")...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --columns: %w", err)
+		}
+		out.columns = columns
+	}
+	
+	if text, _ := cmd.Flags().GetString("template"); text != "" {
+		// Unescape so \t and \n can be typed on the command line
+		text = strings.NewReplacer(`\t`, "\t", `\n`, "\n").Replace(text)
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		
+		tmpl, err := template.New("file").Funcs(templateFuncs(dir)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --template: %w", err)
+		}
+		out.template = tmpl
+	}
+	
+	return out, nil
+}
+
+// templateFuncs are the helpers available to --template, besides the
+// text/template builtins
+func templateFuncs(dir string) template.FuncMap {
+	return template.FuncMap{
+		"human": formatBytes,
+		"ago":   relativeTime,
+		"date": func(layout string, t time.Time) string {
+			return t.Format(layout)
+		},
+		"base": filepath.Base,
+		"dir":  filepath.Dir,
+		"ext":  filepath.Ext,
+		"stem": func(path string) string {
+			name := filepath.Base(path)
+			return strings.TrimSuffix(name, filepath.Ext(name))
+		},
+		"rel": func(path string) string {
+			if rel, err := filepath.Rel(dir, path); err == nil {
+				return rel
+			}
+			return path
+		},
+		"abs": func(path string) string {
+			if abs, err := filepath.Abs(path); err == nil {
+				return abs
+			}
+			return path
+		},
+		"mime":  mimetype.Fill,
+		"join":  filepath.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"pad": func(width int, s string) string {
+			return fmt.Sprintf("%-*s", width, s)
+		},
+	}
+}
+
+// outputTemplate prints every file with the --template
+func outputTemplate(tmpl *template.Template, files []*models.FileInfo) {
+	for _, file := range files {
+		checkError(tmpl.Execute(os.Stdout, file))
+	}
+}
+
+// displayMode is a file's mode as ls shows it
+func displayMode(file *models.FileInfo) string {
+	mode := file.Mode
+	if file.IsDir {
+		mode = "d" + mode[1:]
+	}
+	return mode[:10]
+}
+
+// relativeTime describes how long ago t was, e.g. "3 days ago"
+func relativeTime(t time.Time) string {
+	d := time.Since(t)
+	suffix := "ago"
+	if d < 0 {
+		d, suffix = -d, "from now"
+	}
+	
+	units := []struct {
+		name   string
+		length time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	
+	for _, unit := range units {
+		if n := int(d / unit.length); n >= 1 {
+			if n > 1 {
+				return fmt.Sprintf("%d %ss %s", n, unit.name, suffix)
+			}
+			return fmt.Sprintf("1 %s %s", unit.name, suffix)
+		}
+	}
+	return "just now"
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// isDelimited reports whether format is one of the delimited text formats
+func isDelimited(format string) bool {
+	return format == "csv" || format == "tsv"
+}
+
+// newDelimitedWriter returns a writer producing RFC 4180 CSV, or
+// tab-separated values when comma is a tab
+func newDelimitedWriter(w io.Writer, comma rune) *csv.Writer {
+	records := csv.NewWriter(w)
+	records.Comma = comma
+	return records
+}
+
+// Helpers formatting values for delimited output
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
+
+func int64toa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func btoa(b bool) string {
+	return strconv.FormatBool(b)
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/filer/internal/fileops"
+	"github.com/user/filer/internal/models"
+)
+
+var dupesCmd = &cobra.Command{
+	Use:   "dupes [directory...]",
+	Short: "Find duplicate files",
+	Long: `Find files with identical contents in one or more directories.
+Files are compared by size first, then by a hash of their first bytes,
+and finally by a full SHA-256 hash. Each duplicate set is reported with
+the space wasted by the extra copies.
+
+With --action, duplicates are resolved: "link" replaces each copy with a
+hard link to the kept file (same filesystem only) and "delete" removes
+every copy but the kept one. --keep chooses the file that stays. Changes
+are recorded in a journal (by default .filer-journal.jsonl in the first
+directory). Use --dry-run to preview the actions.
+If no directory is specified, the current directory is used.`,
+	Aliases: []string{"duplicates", "dup"},
+	Run:     runDupes,
+}
+
+func init() {
+	rootCmd.AddCommand(dupesCmd)
+	
+	dupesCmd.Flags().BoolP("hidden", "H", false, "include hidden files")
+	dupesCmd.Flags().StringP("extension", "e", "", "filter by file extension")
+	dupesCmd.Flags().StringP("min-size", "m", "", "minimum file size (e.g. 512k, 10MB, 1.5GiB)")
+	dupesCmd.Flags().StringP("max-size", "M", "", "maximum file size (e.g. 512k, 10MB, 1.5GiB)")
+	dupesCmd.Flags().StringP("where", "w", "", "filter expression, e.g. 'ext in (iso,zip) and size > 100MB'")
+	dupesCmd.Flags().StringP("action", "a", "", "resolve duplicates: link, delete")
+	dupesCmd.Flags().StringP("keep", "k", fileops.KeepOldest, "file to keep: oldest, newest, shortest, priority")
+	dupesCmd.Flags().StringSlice("priority", nil, "directories in order of preference for --keep priority")
+	dupesCmd.Flags().StringP("journal", "j", "", "journal file (default: .filer-journal.jsonl in the first directory)")
+	dupesCmd.Flags().BoolP("dry-run", "n", false, "show what would be done without making changes")
+	dupesCmd.Flags().BoolP("confirm", "y", false, "skip confirmation prompt")
+}
+
+func runDupes(cmd *cobra.Command, args []string) {
+	// Get directories to scan
+	dirs := args
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	
+	// Parse flags
+	includeHidden, _ := cmd.Flags().GetBool("hidden")
+	extension, _ := cmd.Flags().GetString("extension")
+	where, _ := cmd.Flags().GetString("where")
+	
+	minSize, err := getSizeFlag(cmd, "min-size")
+	checkError(err)
+	maxSize, err := getSizeFlag(cmd, "max-size")
+	checkError(err)
+	filter, err := compileWhere(where)
+	checkError(err)
+	
+	opts := models.SearchOptions{
+		Extension:     extension,
+		MinSize:       minSize,
+		MaxSize:       maxSize,
+		IncludeHidden: includeHidden,
+		Recursive:     true,
+		Filter:        filter,
+	}
+	
+	if isVerbose() {
+		notef("Scanning %s for duplicates...\n", strings.Join(dirs, ", "))
+	}
+	
+	sets, err := fileops.FindDuplicates(dirs, opts)
+	checkError(err)
+	
+	action, _ := cmd.Flags().GetString("action")
+	if action != "" {
+		resolveDupes(cmd, dirs, sets, action)
+		return
+	}
+	
+	render(&report{
+		Title:  "Duplicate files",
+		Data:   sets,
+		Tables: func() []*dataTable { return []*dataTable{dupesTable(sets)} },
+		Text:   func() { outputDupesTable(sets) },
+	})
+}
+
+func resolveDupes(cmd *cobra.Command, dirs []string, sets []*models.DuplicateSet, action string) {
+	keep, _ := cmd.Flags().GetString("keep")
+	priority, _ := cmd.Flags().GetStringSlice("priority")
+	journalPath, _ := cmd.Flags().GetString("journal")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	skipConfirm, _ := cmd.Flags().GetBool("confirm")
+	
+	if journalPath == "" {
+		journalPath = filepath.Join(dirs[0], fileops.JournalName)
+	}
+	
+	opts := models.DedupeOptions{
+		Action:      action,
+		Keep:        keep,
+		Priority:    priority,
+		DryRun:      true,
+		JournalPath: journalPath,
+	}
+	
+	// Plan first to show a preview
+	planned, err := fileops.ResolveDuplicates(sets, opts)
+	checkError(err)
+	
+	if len(planned) == 0 {
+		notef("No duplicate files found\n")
+		return
+	}
+	
+	if dryRun || !skipConfirm {
+		outputDedupeResults(planned, "Duplicates will be resolved as follows:")
+	}
+	
+	if dryRun {
+		notef("\n(This was a dry run - no files were changed)\n")
+		return
+	}
+	
+	// Confirm unless skip flag is set
+	if !skipConfirm {
+		notef("\nProceed to %s %d duplicate files? (y/N): ", action, len(planned))
+		var response string
+		fmt.Scanln(&response)
+		
+		if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
+			notef("Dedupe cancelled\n")
+			return
+		}
+	}
+	
+	opts.DryRun = false
+	results, err := fileops.ResolveDuplicates(sets, opts)
+	outputDedupeResults(results, "Resolved duplicates:")
+	checkError(err)
+	
+	if isVerbose() {
+		notef("Journal written to %s\n", journalPath)
+	}
+}
+
+func outputDedupeResults(results []*models.DedupeResult, title string) {
+	render(&report{
+		Title: title,
+		Data:  results,
+		Tables: func() []*dataTable {
+			rows := make([][]string, 0, len(results))
+			for _, result := range results {
+				rows = append(rows, []string{result.Action, result.Path, result.Keeper, int64toa(result.Size), result.Reason})
+			}
+			return []*dataTable{{Header: []string{"action", "path", "keeper", "size", "reason"}, Rows: rows}}
+		},
+		Text: func() { outputDedupeTable(results, title) },
+	})
+}
+
+func outputDedupeTable(results []*models.DedupeResult, title string) {
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", 50))
+	
+	var reclaimed int64
+	keeper := ""
+	for _, result := range results {
+		if result.Keeper != keeper {
+			keeper = result.Keeper
+			fmt.Printf("\nkeep    %s\n", keeper)
+		}
+		
+		if result.Reason != "" {
+			fmt.Printf("  %-6s %s (%s)\n", result.Action, result.Path, result.Reason)
+		} else {
+			fmt.Printf("  %-6s %s\n", result.Action, result.Path)
+		}
+		
+		if result.Action != "skip" {
+			reclaimed += result.Size
+		}
+	}
+	
+	fmt.Printf("\nTotal: %d duplicates, %s reclaimable\n", len(results), formatBytes(reclaimed))
+}
+
+func outputDupesTable(sets []*models.DuplicateSet) {
+	if len(sets) == 0 {
+		fmt.Println("No duplicate files found")
+		return
+	}
+	
+	var totalWasted int64
+	totalFiles := 0
+	
+	for i, set := range sets {
+		fmt.Printf("Set %d: %d files, %s each, %s wasted (sha256 %s)\n",
+			i+1, len(set.Files), set.SizeHuman, set.WastedHuman, set.Hash[:12])
+		for _, file := range set.Files {
+			fmt.Printf("  %s\n", file.Path)
+		}
+		fmt.Println()
+		
+		totalWasted += set.WastedBytes
+		totalFiles += len(set.Files) - 1
+	}
+	
+	fmt.Printf("Total: %d duplicate sets, %d redundant files, %s wasted\n",
+		len(sets), totalFiles, formatBytes(totalWasted))
+}
+
+// dupesTable lays out duplicate sets for the tabular formats, one row per
+// file
+func dupesTable(sets []*models.DuplicateSet) *dataTable {
+	var rows [][]string
+	for i, set := range sets {
+		for _, file := range set.Files {
+			rows = append(rows, []string{itoa(i + 1), set.Hash, int64toa(set.Size), file.Path})
+		}
+	}
+	
+	return &dataTable{Header: []string{"set", "hash", "size", "path"}, Rows: rows}
+}
@@ -1,13 +1,13 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/user/filer/internal/fileops"
+	"github.com/user/filer/internal/mimetype"
 	"github.com/user/filer/internal/models"
 )
 
@@ -15,6 +15,15 @@ var listCmd = &cobra.Command{
 	Use:   "list [directory]",
 	Short: "List files and directories",
 	Long: `List files and directories in the specified path with various filtering and sorting options.
+Use --columns to pick the columns of table and tabular output, or --template
+to print each file with a Go text/template over its fields (.Name, .Path,
+.Size, .ModTime, ...), with the helpers human, ago, date, base, dir, ext,
+stem, rel, abs, join, upper, lower, pad and mime:
+
+  filer list --template '{{human .Size}}\t{{ago .ModTime}}\t{{rel .Path}}'
+
+With --sort none, files are printed as they are found instead of after the
+whole tree has been read (except with the json, yaml, html and tree formats).
 If no directory is specified, the current directory is used.`,
 	Aliases: []string{"ls", "l"},
 	Args:    cobra.MaximumNArgs(1),
@@ -26,13 +35,19 @@ func init() {
 	
 	listCmd.Flags().BoolP("recursive", "r", false, "list files recursively")
 	listCmd.Flags().BoolP("all", "a", false, "include hidden files")
-	listCmd.Flags().StringP("sort", "s", "name", "sort by: name, size, modified, extension")
+	listCmd.Flags().StringP("sort", "s", "name", "sort by: name, size, modified, extension, none (print as found)")
 	listCmd.Flags().BoolP("reverse", "R", false, "reverse sort order")
 	listCmd.Flags().BoolP("dirs-only", "d", false, "list directories only")
 	listCmd.Flags().BoolP("files-only", "F", false, "list files only")
 	listCmd.Flags().StringP("extension", "e", "", "filter by file extension")
-	listCmd.Flags().Int64P("min-size", "m", 0, "minimum file size in bytes")
-	listCmd.Flags().Int64P("max-size", "M", 0, "maximum file size in bytes")
+	listCmd.Flags().StringP("min-size", "m", "", "minimum file size (e.g. 512k, 10MB, 1.5GiB)")
+	listCmd.Flags().StringP("max-size", "M", "", "maximum file size (e.g. 512k, 10MB, 1.5GiB)")
+	listCmd.Flags().String("modified-since", "", "modified since date, time or age (e.g. 2024-01-31, yesterday, 7d)")
+	listCmd.Flags().String("modified-before", "", "modified before date, time or age (e.g. 2024-01-31, yesterday, 7d)")
+	listCmd.Flags().String("mime", "", "filter by detected MIME type (e.g. image/*, application/pdf)")
+	listCmd.Flags().Bool("show-mime", false, "detect and show each file's MIME type")
+	listCmd.Flags().StringP("where", "w", "", "filter expression, e.g. 'ext in (go,md) and size > 10MiB and age < 7d'")
+	addOutputFlags(listCmd)
 }
 
 func runList(cmd *cobra.Command, args []string) {
@@ -50,111 +65,315 @@ func runList(cmd *cobra.Command, args []string) {
 	dirsOnly, _ := cmd.Flags().GetBool("dirs-only")
 	filesOnly, _ := cmd.Flags().GetBool("files-only")
 	extension, _ := cmd.Flags().GetString("extension")
-	minSize, _ := cmd.Flags().GetInt64("min-size")
-	maxSize, _ := cmd.Flags().GetInt64("max-size")
+	mimeType, _ := cmd.Flags().GetString("mime")
+	showMime, _ := cmd.Flags().GetBool("show-mime")
+	where, _ := cmd.Flags().GetString("where")
+	
+	minSize, err := getSizeFlag(cmd, "min-size")
+	checkError(err)
+	maxSize, err := getSizeFlag(cmd, "max-size")
+	checkError(err)
+	modifiedSince, err := getTimeFlag(cmd, "modified-since")
+	checkError(err)
+	modifiedBefore, err := getTimeFlag(cmd, "modified-before")
+	checkError(err)
+	filter, err := compileWhere(where)
+	checkError(err)
+	out, err := getFileOutput(cmd, dir)
+	checkError(err)
+	
+	criteria := models.SearchOptions{
+		Extension:      extension,
+		MinSize:        minSize,
+		MaxSize:        maxSize,
+		ModifiedSince:  modifiedSince,
+		ModifiedBefore: modifiedBefore,
+		MimeType:       mimeType,
+		Filter:         filter,
+	}
+	
+	detectMime := showMime || out.hasColumn("mime_type")
+	
+	// Unsorted output is printed as files are found instead of collected
+	if sortBy == "none" && (out.template != nil || isIncremental()) {
+		stream := newFileStream(out, detectMime)
+		checkError(fileops.ListFilesFunc(dir, recursive, showHidden, func(file *models.FileInfo) error {
+			if matchesListFilters(file, criteria, dirsOnly, filesOnly) {
+				stream.print(file)
+			}
+			return nil
+		}))
+		stream.finish("No files found")
+		return
+	}
 	
 	// List files
 	files, err := fileops.ListFiles(dir, recursive, showHidden)
 	checkError(err)
 	
 	// Apply filters
-	filteredFiles := filterFiles(files, extension, minSize, maxSize, dirsOnly, filesOnly)
+	filteredFiles := filterFiles(files, criteria, dirsOnly, filesOnly)
 	
 	// Sort files
 	fileops.SortFiles(filteredFiles, sortBy, reverse)
 	
+	if detectMime {
+		fillMimeTypes(filteredFiles)
+	}
+	
 	// Output results
-	outputFiles(filteredFiles, getOutputFormat())
+	outputFiles(dir, filteredFiles, out)
 }
 
-func filterFiles(files []*models.FileInfo, extension string, minSize, maxSize int64, dirsOnly, filesOnly bool) []*models.FileInfo {
-	var filtered []*models.FileInfo
+func filterFiles(files []*models.FileInfo, criteria models.SearchOptions, dirsOnly, filesOnly bool) []*models.FileInfo {
+	filtered := []*models.FileInfo{}
 	
 	for _, file := range files {
-		// Directory/file filter
-		if dirsOnly && !file.IsDir {
-			continue
-		}
-		if filesOnly && file.IsDir {
-			continue
-		}
-		
-		// Extension filter
-		if extension != "" && strings.ToLower(file.Extension) != strings.ToLower(extension) {
-			continue
-		}
-		
-		// Size filters (only for files)
-		if !file.IsDir {
-			if minSize > 0 && file.Size < minSize {
-				continue
-			}
-			if maxSize > 0 && file.Size > maxSize {
-				continue
-			}
+		if matchesListFilters(file, criteria, dirsOnly, filesOnly) {
+			filtered = append(filtered, file)
 		}
-		
-		filtered = append(filtered, file)
 	}
 	
 	return filtered
 }
 
-func outputFiles(files []*models.FileInfo, format string) {
-	switch format {
-	case "json":
-		outputJSON(files)
-	case "csv":
-		outputCSV(files)
-	default:
-		outputTable(files)
+func matchesListFilters(file *models.FileInfo, criteria models.SearchOptions, dirsOnly, filesOnly bool) bool {
+	if dirsOnly && !file.IsDir {
+		return false
+	}
+	if filesOnly && file.IsDir {
+		return false
+	}
+	return fileops.MatchesFilters(file, criteria)
+}
+
+// fillMimeTypes detects the MIME type of every file that lacks one. This
+// reads every file, so it only happens on request.
+func fillMimeTypes(files []*models.FileInfo) {
+	for _, file := range files {
+		mimetype.Fill(file)
+	}
+}
+
+// hasMimeTypes reports whether any file has a known MIME type, in which case
+// table and CSV output include a MIME column
+func hasMimeTypes(files []*models.FileInfo) bool {
+	for _, file := range files {
+		if file.MimeType != "" {
+			return true
+		}
 	}
+	return false
 }
 
-func outputTable(files []*models.FileInfo) {
+func outputFiles(dir string, files []*models.FileInfo, out *fileOutput) {
+	if out.template != nil {
+		outputTemplate(out.template, files)
+		return
+	}
+	
+	render(&report{
+		Title:  fmt.Sprintf("Files in %s", dir),
+		Data:   files,
+		Tables: func() []*dataTable { return []*dataTable{filesTable(files, out.columns)} },
+		Text:   func() { outputTable(files, out.columns) },
+		Tree:   func() { outputTree(dir, files, out) },
+	})
+}
+
+func outputTable(files []*models.FileInfo, columns []*fileColumn) {
 	if len(files) == 0 {
 		fmt.Println("No files found")
 		return
 	}
 	
-	// Print header
-	fmt.Printf("%-10s %-12s %-20s %s\n", "MODE", "SIZE", "MODIFIED", "NAME")
-	fmt.Println(strings.Repeat("-", 80))
-	
+	columns = tableColumns(columns, hasMimeTypes(files))
+	printTableHeader(columns)
 	for _, file := range files {
-		mode := file.Mode
-		if file.IsDir {
-			mode = "d" + mode[1:]
+		printTableRow(columns, file)
+	}
+	
+	fmt.Printf("\nTotal: %d items\n", len(files))
+}
+
+// tableColumns returns the columns of the table format: those chosen, or
+// the defaults
+func tableColumns(columns []*fileColumn, showMime bool) []*fileColumn {
+	if columns != nil {
+		return columns
+	}
+	
+	columns = mustColumns("mode", "size", "modified")
+	if showMime {
+		columns = append(columns, mustColumns("mime_type")...)
+	}
+	return append(columns, mustColumns("name")...)
+}
+
+func printTableHeader(columns []*fileColumn) {
+	ruleWidth := 35
+	for _, column := range columns[:len(columns)-1] {
+		ruleWidth += column.width + 1
+	}
+	
+	printTableCells(columns, func(column *fileColumn) string { return column.header })
+	fmt.Println(strings.Repeat("-", ruleWidth))
+}
+
+func printTableRow(columns []*fileColumn, file *models.FileInfo) {
+	printTableCells(columns, func(column *fileColumn) string { return column.display(file) })
+}
+
+// printTableCells prints a line of the table, padding every column but the
+// last to its width
+func printTableCells(columns []*fileColumn, cell func(column *fileColumn) string) {
+	var line strings.Builder
+	for i, column := range columns {
+		if i == len(columns)-1 {
+			line.WriteString(cell(column))
+			break
+		}
+		fmt.Fprintf(&line, "%-*s ", column.width, cell(column))
+	}
+	fmt.Println(line.String())
+}
+
+func outputTree(dir string, files []*models.FileInfo, out *fileOutput) {
+	if len(files) == 0 {
+		fmt.Println("No files found")
+		return
+	}
+	
+	root := fileops.BuildTree(dir, files, out.sortBy, out.reverse)
+	
+	fmt.Printf("%s/ (%d items, %s)\n", strings.TrimSuffix(dir, "/"), root.ItemCount, formatBytes(root.TotalSize))
+	printTreeChildren(root, "")
+	
+	fmt.Printf("\nTotal: %d items\n", countTreeEntries(root))
+}
+
+// countTreeEntries returns the number of entries printed below node
+func countTreeEntries(node *models.TreeNode) int {
+	count := len(node.Children)
+	for _, child := range node.Children {
+		count += countTreeEntries(child)
+	}
+	return count
+}
+
+func printTreeChildren(node *models.TreeNode, prefix string) {
+	for i, child := range node.Children {
+		connector, indent := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			connector, indent = "└── ", "    "
+		}
+		
+		if child.Info.IsDir {
+			fmt.Printf("%s%s%s/ (%d items, %s)\n",
+				prefix, connector, child.Info.Name, child.ItemCount, formatBytes(child.TotalSize))
+			printTreeChildren(child, prefix+indent)
+			continue
 		}
 		
-		fmt.Printf("%-10s %-12s %-20s %s\n",
-			mode[:10],
-			file.SizeHuman,
-			file.ModTime.Format("2006-01-02 15:04:05"),
-			file.Name)
+		fmt.Printf("%s%s%s (%s)\n", prefix, connector, child.Info.Name, child.Info.SizeHuman)
+	}
+}
+
+// recordColumns returns the columns of the tabular formats: those chosen,
+// or the defaults
+func recordColumns(columns []*fileColumn, showMime bool) []*fileColumn {
+	if columns != nil {
+		return columns
 	}
 	
-	fmt.Printf("\nTotal: %d items\n", len(files))
+	columns = mustColumns("name", "path", "size", "size_human", "modified", "mode", "is_dir", "extension")
+	if showMime {
+		columns = append(columns, mustColumns("mime_type")...)
+	}
+	return columns
+}
+
+// fileStream prints files one at a time as a traversal finds them
+type fileStream struct {
+	out        *fileOutput
+	detectMime bool
+	text       []*fileColumn
+	records    []*fileColumn
+	count      int
+}
+
+func newFileStream(out *fileOutput, detectMime bool) *fileStream {
+	return &fileStream{
+		out:        out,
+		detectMime: detectMime,
+		text:       tableColumns(out.columns, detectMime),
+		records:    recordColumns(out.columns, detectMime),
+	}
+}
+
+// print writes one file in the chosen format
+func (s *fileStream) print(file *models.FileInfo) {
+	if s.detectMime {
+		mimetype.Fill(file)
+	}
+	first := s.count == 0
+	s.count++
+	
+	if s.out.template != nil {
+		checkError(s.out.template.Execute(os.Stdout, file))
+		return
+	}
+	
+	renderItem(&report{
+		Data:   file,
+		Tables: func() []*dataTable { return []*dataTable{filesTable([]*models.FileInfo{file}, s.records)} },
+		Text: func() {
+			if first {
+				printTableHeader(s.text)
+			}
+			printTableRow(s.text, file)
+		},
+	}, first)
 }
 
-func outputJSON(files []*models.FileInfo) {
-	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetIndent("", "  ")
-	checkError(encoder.Encode(files))
+// finish ends the table format with the total. When nothing was printed it
+// writes the empty document of the format instead: empty in the table
+// format, or just the header of the tabular ones.
+func (s *fileStream) finish(empty string) {
+	if s.out.template != nil {
+		return
+	}
+	if s.count == 0 {
+		render(&report{
+			Data:   []*models.FileInfo{},
+			Tables: func() []*dataTable { return []*dataTable{filesTable(nil, s.records)} },
+			Text:   func() { fmt.Println(empty) },
+		})
+		return
+	}
+	if getOutputFormat() == "table" {
+		fmt.Printf("\nTotal: %d items\n", s.count)
+	}
 }
 
-func outputCSV(files []*models.FileInfo) {
-	fmt.Println("name,path,size,size_human,modified,mode,is_dir,extension")
+// filesTable lays out files for the tabular formats, with the default
+// columns unless others are given
+func filesTable(files []*models.FileInfo, columns []*fileColumn) *dataTable {
+	columns = recordColumns(columns, hasMimeTypes(files))
+	
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
 	
+	rows := make([][]string, 0, len(files))
 	for _, file := range files {
-		fmt.Printf("%q,%q,%d,%q,%q,%q,%t,%q\n",
-			file.Name,
-			file.Path,
-			file.Size,
-			file.SizeHuman,
-			file.ModTime.Format("2006-01-02 15:04:05"),
-			file.Mode,
-			file.IsDir,
-			file.Extension)
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = column.value(file)
+		}
+		rows = append(rows, row)
 	}
+	
+	return &dataTable{Header: header, Rows: rows}
 }
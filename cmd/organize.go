@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/user/filer/internal/fileops"
+	"github.com/user/filer/internal/models"
 )
 
 var organizeCmd = &cobra.Command{
@@ -13,6 +21,46 @@ var organizeCmd = &cobra.Command{
 	Short: "Organize files into subdirectories by type",
 	Long: `Organize files in the specified directory into subdirectories based on file type.
 Files are categorized into: images, videos, audio, documents, archives, and other.
+
+Categories can be customized with a JSON rules file, given with --config or
+found as .filer-rules.json in the directory or rules.json in the user's
+filer config directory. Rules are tried in order and may match on
+extensions, glob, regex, min_size/max_size, older_than/newer_than and
+mime_type, sending files to a dest template such as "code/{ext}":
+
+  {"rules": [
+    {"name": "code", "extensions": ["go", "py"], "dest": "code/{ext}"},
+    {"name": "logs", "glob": "*.log", "older_than": "30d"}
+  ]}
+
+Use --rules to validate the rules without organizing anything.
+
+With --layout date files are filed by date into {year}/{month} folders
+instead, using the EXIF date taken for JPEG photos and the modification
+time otherwise. --dest sets a custom destination template for every file;
+it may use {year}, {month}, {day}, {date}, {category}, {ext} and {name},
+e.g. --dest '{year}/{month}/{category}'.
+
+With --recursive, files in subdirectories (up to --max-depth levels) are
+organized too: each subdirectory in place, or into the top-level
+categories with --flatten. Directories created by earlier runs, and
+directories named after a category or a destination's first level (such
+as the year folders of --layout date), are never descended into.
+
+With --sniff files are categorized by their detected content type instead
+of trusting their extension, so extension-less downloads and mislabeled
+files land in the right place; files whose extension disagrees with their
+contents are flagged in the preview.
+
+With --watch, filer keeps running and organizes files as they arrive,
+waiting until a file has stopped changing for the --settle delay so
+half-written files are not moved. Press Ctrl+C to stop. The whole watch
+session is recorded as one run, so 'filer undo' reverts all of it.
+Every move is recorded in a journal so the run can be reversed with 'filer undo'.
+Files replaced by --conflict overwrite or keep-newer are kept beside the
+new file under a hidden .filer-overwritten-* name so undo can restore them;
+'filer undo --commit' deletes them once the runs no longer need undoing.
+A directory at the destination is never replaced.
 If no directory is specified, the current directory is used.`,
 	Aliases: []string{"org", "o"},
 	Args:    cobra.MaximumNArgs(1),
@@ -24,6 +72,19 @@ func init() {
 	
 	organizeCmd.Flags().BoolP("dry-run", "n", false, "show what would be organized without making changes")
 	organizeCmd.Flags().BoolP("confirm", "y", false, "skip confirmation prompt")
+	organizeCmd.Flags().String("config", "", "organize rules file (JSON)")
+	organizeCmd.Flags().Bool("rules", false, "validate and show the organize rules, then exit")
+	organizeCmd.Flags().StringP("layout", "l", fileops.LayoutType, "organize layout: type, date")
+	organizeCmd.Flags().String("dest", "", "destination path template, e.g. '{year}/{month}/{category}'")
+	organizeCmd.Flags().Bool("sniff", false, "categorize files by detected content type rather than extension")
+	organizeCmd.Flags().BoolP("recursive", "r", false, "also organize files in subdirectories")
+	organizeCmd.Flags().IntP("max-depth", "d", 0, "maximum directory depth for --recursive (0 = unlimited)")
+	organizeCmd.Flags().Bool("flatten", false, "with --recursive, move files into the top-level categories")
+	organizeCmd.Flags().BoolP("watch", "w", false, "keep running and organize files as they arrive")
+	organizeCmd.Flags().Duration("settle", 2*time.Second, "with --watch, how long a file must stay unchanged before it is moved")
+	organizeCmd.Flags().Bool("poll", false, "with --watch, poll for changes instead of using inotify")
+	organizeCmd.Flags().StringP("conflict", "c", fileops.ConflictRename,
+		"when the destination exists: skip, rename, overwrite, keep-newer, skip-if-identical")
 }
 
 func runOrganize(cmd *cobra.Command, args []string) {
@@ -36,64 +97,437 @@ func runOrganize(cmd *cobra.Command, args []string) {
 	// Get flags
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 	skipConfirm, _ := cmd.Flags().GetBool("confirm")
+	conflict, _ := cmd.Flags().GetString("conflict")
+	
+	layout, _ := cmd.Flags().GetString("layout")
+	template, _ := cmd.Flags().GetString("dest")
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	maxDepth, _ := cmd.Flags().GetInt("max-depth")
+	flatten, _ := cmd.Flags().GetBool("flatten")
+	sniff, _ := cmd.Flags().GetBool("sniff")
+	watch, _ := cmd.Flags().GetBool("watch")
+	settle, _ := cmd.Flags().GetDuration("settle")
+	poll, _ := cmd.Flags().GetBool("poll")
+	configPath, _ := cmd.Flags().GetString("config")
+	validateOnly, _ := cmd.Flags().GetBool("rules")
+	
+	rules, rulesSource, err := loadOrganizeRules(dir, configPath)
+	checkError(err)
+	
+	if validateOnly {
+		validateOrganizeRules(rules, rulesSource)
+		return
+	}
+	
+	if isVerbose() {
+		notef("Using rules from %s\n", rulesSource)
+	}
+	
+	opts := models.OrganizeOptions{
+		DryRun:    true,
+		Conflict:  conflict,
+		Rules:     rules,
+		Layout:    layout,
+		Template:  template,
+		Recursive: recursive,
+		MaxDepth:  maxDepth,
+		Flatten:   flatten,
+		Sniff:     sniff,
+	}
+	
+	if watch {
+		opts.DryRun = dryRun
+		watchAndOrganize(dir, opts, settle, poll)
+		return
+	}
 	
 	if isVerbose() {
 		if dryRun {
-			fmt.Printf("Dry run: Analyzing organization for '%s'...\n", dir)
+			notef("Dry run: Analyzing organization for '%s'...\n", dir)
 		} else {
-			fmt.Printf("Organizing files in '%s'...\n", dir)
+			notef("Organizing files in '%s'...\n", dir)
 		}
 	}
 	
 	// Perform organization (dry run first to show preview)
-	organized, err := fileops.OrganizeFiles(dir, true)
+	organized, err := fileops.OrganizeFiles(dir, opts)
 	checkError(err)
 	
 	if len(organized) == 0 {
-		fmt.Println("No files to organize")
+		notef("No files to organize\n")
 		return
 	}
 	
-	// Show what will be organized
-	fmt.Println("Files will be organized as follows:")
-	fmt.Println(strings.Repeat("=", 50))
-	
-	totalFiles := 0
-	for category, files := range organized {
-		fmt.Printf("\n%s/ (%d files):\n", strings.Title(category), len(files))
-		for _, file := range files {
-			fmt.Printf("  - %s\n", file)
-			totalFiles++
-		}
+	// Show what will be organized; the other formats only print the
+	// results when there is nothing to confirm
+	if dryRun || !skipConfirm || isTextFormat() {
+		outputOrganized(organized, "Organize plan", func() { printOrganizePlan(organized) })
 	}
 	
-	fmt.Printf("\nTotal files to organize: %d\n", totalFiles)
-	
 	if dryRun {
-		fmt.Println("\n(This was a dry run - no files were moved)")
+		notef("\n(This was a dry run - no files were moved)\n")
 		return
 	}
 	
 	// Confirm unless skip flag is set
 	if !skipConfirm {
-		fmt.Print("\nProceed with organization? (y/N): ")
+		notef("\nProceed with organization? (y/N): ")
 		var response string
 		fmt.Scanln(&response)
 		
 		if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
-			fmt.Println("Organization cancelled")
+			notef("Organization cancelled\n")
 			return
 		}
 	}
 	
 	// Perform actual organization
-	fmt.Println("\nOrganizing files...")
-	_, err = fileops.OrganizeFiles(dir, false)
+	notef("\nOrganizing files...\n")
+	opts.DryRun = false
+	organized, err = fileops.OrganizeFiles(dir, opts)
+	outputOrganized(organized, "Organized files", func() { printOrganizeSummary(organized) })
 	checkError(err)
 	
-	fmt.Println("✓ Files organized successfully!")
+	notef("✓ Files organized successfully!\n")
 	
 	if isVerbose() {
-		fmt.Printf("Organized %d files into %d categories\n", totalFiles, len(organized))
+		notef("Organized %d files into %d categories\n", countOrganized(organized), len(organized))
+	}
+}
+
+// outputOrganized renders organize entries in the --format chosen by the
+// user; text prints the table format
+func outputOrganized(organized map[string][]*models.OrganizeEntry, title string, text func()) {
+	entries := organizeEntries(organized)
+	render(&report{
+		Title: title,
+		Data:  entries,
+		Tables: func() []*dataTable {
+			rows := make([][]string, 0, len(entries))
+			for _, entry := range entries {
+				rows = append(rows, organizeRow(entry))
+			}
+			return []*dataTable{{Header: organizeHeader, Rows: rows}}
+		},
+		Text: text,
+	})
+}
+
+// organizeHeader names the columns of organizeRow
+var organizeHeader = []string{"category", "action", "name", "source", "target", "reason", "mime_type", "mismatch", "backup"}
+
+func organizeRow(entry *models.OrganizeEntry) []string {
+	return []string{entry.Category, entry.Action, entry.Name, entry.Source, entry.Target,
+		entry.Reason, entry.MimeType, btoa(entry.Mismatch), entry.Backup}
+}
+
+// organizeEntries flattens organize results in category order
+func organizeEntries(organized map[string][]*models.OrganizeEntry) []*models.OrganizeEntry {
+	entries := make([]*models.OrganizeEntry, 0, len(organized))
+	for _, category := range organizeCategories(organized) {
+		entries = append(entries, organized[category]...)
+	}
+	return entries
+}
+
+func organizeCategories(organized map[string][]*models.OrganizeEntry) []string {
+	categories := make([]string, 0, len(organized))
+	for category := range organized {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// countOrganized returns the number of files that are not skipped
+func countOrganized(organized map[string][]*models.OrganizeEntry) int {
+	total := 0
+	for _, entries := range organized {
+		for _, entry := range entries {
+			if entry.Action != fileops.ActionSkip {
+				total++
+			}
+		}
+	}
+	return total
+}
+
+// printOrganizePlan prints the organize preview grouped by category
+func printOrganizePlan(organized map[string][]*models.OrganizeEntry) {
+	fmt.Println("Files will be organized as follows:")
+	fmt.Println(strings.Repeat("=", 50))
+	
+	for _, category := range organizeCategories(organized) {
+		entries := organized[category]
+		fmt.Printf("\n%s/ (%d files):\n", strings.Title(category), len(entries))
+		for _, entry := range entries {
+			fmt.Printf("  - %s\n", describeOrganizeEntry(entry))
+		}
+	}
+	
+	fmt.Printf("\nTotal files to organize: %d\n", countOrganized(organized))
+}
+
+// describeOrganizeEntry renders a file's planned move for the preview
+func describeOrganizeEntry(entry *models.OrganizeEntry) string {
+	var desc string
+	switch {
+	case entry.Action == fileops.ActionSkip:
+		desc = fmt.Sprintf("%s (skip: %s)", entry.Name, entry.Reason)
+	case entry.Action == fileops.ActionRename:
+		desc = fmt.Sprintf("%s -> %s/%s (rename: %s)", entry.Name, entry.Dest, filepath.Base(entry.Target), entry.Reason)
+	case entry.Action == fileops.ActionOverwrite && entry.Backup != "":
+		desc = fmt.Sprintf("%s (overwrite: %s; replaced file kept as %s)", entry.Name, entry.Reason, filepath.Base(entry.Backup))
+	case entry.Action == fileops.ActionOverwrite:
+		desc = fmt.Sprintf("%s (overwrite: %s; replaced file is kept for undo)", entry.Name, entry.Reason)
+	case entry.Dest != entry.Category:
+		desc = fmt.Sprintf("%s -> %s/", entry.Name, entry.Dest)
+	default:
+		desc = entry.Name
+	}
+	
+	if entry.Mismatch {
+		desc += fmt.Sprintf(" [content is %s, not .%s]", entry.MimeType, strings.TrimPrefix(filepath.Ext(entry.Name), "."))
+	}
+	return desc
+}
+
+// printOrganizeSummary reports the outcome for every file that was not
+// simply moved, followed by per-action counts
+func printOrganizeSummary(organized map[string][]*models.OrganizeEntry) {
+	counts := make(map[string]int)
+	
+	for _, entries := range organized {
+		for _, entry := range entries {
+			counts[entry.Action]++
+			if entry.Action != fileops.ActionMove {
+				fmt.Printf("  - %s\n", describeOrganizeEntry(entry))
+			}
+		}
+	}
+	
+	fmt.Printf("Moved: %d, Renamed: %d, Overwritten: %d, Skipped: %d\n",
+		counts[fileops.ActionMove], counts[fileops.ActionRename],
+		counts[fileops.ActionOverwrite], counts[fileops.ActionSkip])
+}
+
+// loadOrganizeRules loads the rules that apply to dir, returning them along
+// with a description of where they came from
+func loadOrganizeRules(dir, configPath string) ([]models.OrganizeRule, string, error) {
+	if configPath == "" {
+		configPath = fileops.FindRulesFile(dir)
+	}
+	if configPath == "" {
+		return fileops.DefaultRules(), "built-in defaults", nil
+	}
+	
+	rules, err := fileops.LoadRules(configPath)
+	return rules, configPath, err
+}
+
+func validateOrganizeRules(rules []models.OrganizeRule, source string) {
+	issues, err := fileops.ValidateRules(rules)
+	checkError(err)
+	
+	if issues == nil {
+		issues = []models.RuleIssue{}
+	}
+	validation := &models.RulesValidation{Source: source, Rules: rules, Issues: issues}
+	render(&report{
+		Title: "Organize rules from " + source,
+		Data:  validation,
+		Tables: func() []*dataTable {
+			rules := &dataTable{Title: "Rules", Header: []string{"rule", "name", "dest"}}
+			for i, rule := range validation.Rules {
+				rules.Rows = append(rules.Rows, []string{itoa(i + 1), rule.Name, ruleDest(rule)})
+			}
+			issues := &dataTable{Title: "Issues", Header: []string{"rule", "name", "kind", "message"}}
+			for _, issue := range validation.Issues {
+				issues.Rows = append(issues.Rows, []string{itoa(issue.Rule), issue.Name, issue.Kind, issue.Message})
+			}
+			return []*dataTable{rules, issues}
+		},
+		Text: func() { printRulesValidation(validation) },
+	})
+}
+
+func printRulesValidation(validation *models.RulesValidation) {
+	fmt.Printf("Organize rules from %s:\n", validation.Source)
+	fmt.Println(strings.Repeat("=", 50))
+	
+	for i, rule := range validation.Rules {
+		fmt.Printf("%2d. %-12s -> %s/\n", i+1, rule.Name, ruleDest(rule))
+	}
+	fmt.Printf("    %-12s -> %s/\n", "(no match)", fileops.OtherCategory)
+	
+	if len(validation.Issues) == 0 {
+		fmt.Println("\n✓ Rules are valid")
+		return
+	}
+	
+	fmt.Printf("\nFound %d issues:\n", len(validation.Issues))
+	for _, issue := range validation.Issues {
+		fmt.Printf("  rule %d (%s) %s: %s\n", issue.Rule, issue.Name, issue.Kind, issue.Message)
+	}
+}
+
+// ruleDest returns where a rule sends files; it defaults to the rule name
+func ruleDest(rule models.OrganizeRule) string {
+	if rule.Dest == "" {
+		return rule.Name
+	}
+	return rule.Dest
+}
+
+// pendingFile tracks a file waiting to settle before it is organized
+type pendingFile struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+}
+
+// watchAndOrganize organizes files as they arrive in dir until interrupted.
+// Files already present are organized first, once they have settled.
+func watchAndOrganize(dir string, opts models.OrganizeOptions, settle time.Duration, poll bool) {
+	// Fail before watching when the format cannot be streamed
+	checkError(checkStreamFormat(getOutputFormat()))
+	
+	watcher, err := fileops.NewWatcher(dir, fileops.WatchOptions{
+		Recursive:    opts.Recursive,
+		ForcePolling: poll,
+		PollInterval: settle / 2,
+	})
+	checkError(err)
+	defer watcher.Close()
+	
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	
+	notef("Watching '%s' for new files (%s, settle %s). Press Ctrl+C to stop.\n", dir, watcher.Backend, settle)
+	if opts.DryRun {
+		notef("(Dry run - no files will be moved)\n")
+	}
+	
+	// Every batch is recorded as one run so undo reverts the whole session
+	opts.Run = fileops.NewRunID()
+	
+	first := true
+	pending := make(map[string]*pendingFile)
+	track := func(path string) {
+		pending[path] = &pendingFile{size: -1, stableSince: time.Now()}
+	}
+	
+	// Files already present are picked up by a scan, which is repeated
+	// whenever the watcher loses events
+	rescan := func() error {
+		existing, err := fileops.ListFiles(dir, opts.Recursive, false)
+		if err != nil {
+			return err
+		}
+		for _, file := range existing {
+			if _, tracked := pending[file.Path]; !tracked && !file.IsDir {
+				track(file.Path)
+			}
+		}
+		return nil
+	}
+	checkError(rescan())
+	
+	tick := settle / 4
+	if tick < 100*time.Millisecond {
+		tick = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-interrupt:
+			notef("\nStopped watching\n")
+			return
+			
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if errors.Is(err, fileops.ErrEventsLost) {
+				if err := rescan(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+			}
+			
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.IsDir {
+				continue
+			}
+			switch event.Op {
+			case fileops.EventDelete:
+				delete(pending, event.Path)
+			case fileops.EventRename:
+				delete(pending, event.OldPath)
+				track(event.Path)
+			default:
+				track(event.Path)
+			}
+			
+		case now := <-ticker.C:
+			var ready []string
+			for path, p := range pending {
+				info, err := os.Stat(path)
+				if err != nil || info.IsDir() {
+					delete(pending, path)
+					continue
+				}
+				
+				// Any change restarts the settle delay
+				if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+					p.size, p.modTime, p.stableSince = info.Size(), info.ModTime(), now
+					continue
+				}
+				if now.Sub(p.stableSince) >= settle {
+					ready = append(ready, path)
+					delete(pending, path)
+				}
+			}
+			
+			if len(ready) > 0 {
+				sort.Strings(ready)
+				opts.Paths = ready
+				organized, err := fileops.OrganizeFiles(dir, opts)
+				first = logOrganized(organized, first)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// logOrganized prints one timestamped line per organized file, or one
+// item per file in the other formats. It returns whether the next item is
+// still the first of the stream.
+func logOrganized(organized map[string][]*models.OrganizeEntry, first bool) bool {
+	stamp := time.Now().Format("2006-01-02 15:04:05")
+	for _, entry := range organizeEntries(organized) {
+		entry := entry
+		renderItem(&report{
+			Data: entry,
+			Tables: func() []*dataTable {
+				return []*dataTable{{Header: organizeHeader, Rows: [][]string{organizeRow(entry)}}}
+			},
+			Text: func() {
+				if entry.Action == fileops.ActionSkip {
+					fmt.Printf("%s %-9s %s (%s)\n", stamp, entry.Action, entry.Name, entry.Reason)
+					return
+				}
+				fmt.Printf("%s %-9s %s -> %s/%s\n", stamp, entry.Action, entry.Name, entry.Dest, filepath.Base(entry.Target))
+			},
+		}, first)
+		first = false
 	}
+	return first
 }
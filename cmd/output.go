@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// report is what a command hands to the output formatters: its data for
+// the structured formats, tables for the tabular ones and its own
+// human-readable rendering
+type report struct {
+	// Title heads the markdown and html output
+	Title string
+	
+	// Data is encoded by json and yaml; a slice is written one element
+	// per line by ndjson
+	Data interface{}
+	
+	// Tables returns the data as tables. Streamed items hold at most one.
+	Tables func() []*dataTable
+	
+	// Text prints the table format
+	Text func()
+	
+	// Tree prints the tree format; commands without one fall back to Text
+	Tree func()
+}
+
+// dataTable is a titled table of string cells
+type dataTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// outputFormat writes reports in one --format
+type outputFormat struct {
+	// write renders a complete report
+	write func(w io.Writer, r *report) error
+	
+	// stream renders one item of a stream such as watch events, where first
+	// is set for the first item; nil when the format cannot be streamed
+	stream func(w io.Writer, r *report, first bool) error
+	
+	// incremental is set when streaming every item prints the same as
+	// writing them all at once, so results can be printed as they are found
+	incremental bool
+}
+
+// outputFormats is the registry of every --format
+var outputFormats = map[string]*outputFormat{
+	"table": {
+		write:       writeText,
+		stream:      func(w io.Writer, r *report, first bool) error { return writeText(w, r) },
+		incremental: true,
+	},
+	"tree": {
+		write: func(w io.Writer, r *report) error {
+			if r.Tree == nil {
+				return writeText(w, r)
+			}
+			r.Tree()
+			return nil
+		},
+	},
+	"json": {
+		write:  writeJSON,
+		stream: func(w io.Writer, r *report, first bool) error { return writeNDJSON(w, r) },
+	},
+	"ndjson": {
+		write:       writeNDJSON,
+		stream:      func(w io.Writer, r *report, first bool) error { return writeNDJSON(w, r) },
+		incremental: true,
+	},
+	"yaml": {
+		write: func(w io.Writer, r *report) error { return writeYAML(w, r.Data) },
+		stream: func(w io.Writer, r *report, first bool) error {
+			// Each item is its own YAML document
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+			return writeYAML(w, r.Data)
+		},
+	},
+	"csv":      delimitedFormat(','),
+	"tsv":      delimitedFormat('\t'),
+	"markdown": {write: writeMarkdown, stream: streamMarkdown, incremental: true},
+	"html":     {write: writeHTML},
+}
+
+// formatNames lists the registered formats for help and error messages
+func formatNames() string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// checkOutputFormat reports an error for an unknown --format
+func checkOutputFormat(format string) error {
+	if _, ok := outputFormats[format]; !ok {
+		return fmt.Errorf("unknown output format %q (expected one of: %s)", format, formatNames())
+	}
+	return nil
+}
+
+// render writes a report in the --format chosen by the user
+func render(r *report) {
+	checkError(outputFormats[getOutputFormat()].write(os.Stdout, r))
+}
+
+// checkStreamFormat reports an error for a format that cannot be streamed
+func checkStreamFormat(format string) error {
+	if outputFormats[format].stream == nil {
+		return fmt.Errorf("output format %q cannot be streamed", format)
+	}
+	return nil
+}
+
+// isIncremental reports whether the --format chosen by the user can print
+// results as they are found
+func isIncremental() bool {
+	return outputFormats[getOutputFormat()].incremental
+}
+
+// isTextFormat reports whether the --format chosen by the user is one of
+// the human-readable ones
+func isTextFormat() bool {
+	format := getOutputFormat()
+	return format == "table" || format == "tree"
+}
+
+// notef prints a status message or prompt. It goes to stdout beside the
+// human-readable output, and to stderr for every other format so it never
+// mixes with their data.
+func notef(format string, args ...interface{}) {
+	w := os.Stdout
+	if !isTextFormat() {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, format, args...)
+}
+
+// renderItem writes one item of a stream in the --format chosen by the user
+func renderItem(r *report, first bool) {
+	format := getOutputFormat()
+	checkError(checkStreamFormat(format))
+	checkError(outputFormats[format].stream(os.Stdout, r, first))
+}
+
+func writeText(w io.Writer, r *report) error {
+	r.Text()
+	return nil
+}
+
+func writeJSON(w io.Writer, r *report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(r.Data)
+}
+
+// writeNDJSON writes each element of a slice as one line of JSON, or any
+// other value as a single line
+func writeNDJSON(w io.Writer, r *report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	
+	value := reflect.ValueOf(r.Data)
+	if value.Kind() != reflect.Slice {
+		return encoder.Encode(r.Data)
+	}
+	for i := 0; i < value.Len(); i++ {
+		if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delimitedFormat returns the csv (or, with a tab, tsv) format. Reports
+// with several tables are written one after another, separated by a blank
+// line.
+func delimitedFormat(comma rune) *outputFormat {
+	writeTable := func(w io.Writer, table *dataTable, header bool) error {
+		records := newDelimitedWriter(w, comma)
+		if header {
+			if err := records.Write(table.Header); err != nil {
+				return err
+			}
+		}
+		return records.WriteAll(table.Rows)
+	}
+	
+	return &outputFormat{
+		write: func(w io.Writer, r *report) error {
+			for i, table := range r.Tables() {
+				if i > 0 {
+					if _, err := io.WriteString(w, "\n"); err != nil {
+						return err
+					}
+				}
+				if err := writeTable(w, table, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		stream: func(w io.Writer, r *report, first bool) error {
+			table, err := streamTable(r)
+			if table == nil || err != nil {
+				return err
+			}
+			return writeTable(w, table, first)
+		},
+		incremental: true,
+	}
+}
+
+// streamTable returns the table of a streamed item, whose rows continue the
+// items before it. An item can only be streamed as a single table.
+func streamTable(r *report) (*dataTable, error) {
+	tables := r.Tables()
+	switch len(tables) {
+	case 0:
+		return nil, nil
+	case 1:
+		return tables[0], nil
+	}
+	return nil, fmt.Errorf("cannot stream %d tables in one output", len(tables))
+}
+
+// markdownCell escapes a value for a markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func markdownRow(w io.Writer, cells []string) error {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		escaped[i] = markdownCell(cell)
+	}
+	_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+	return err
+}
+
+func markdownHeader(w io.Writer, header []string) error {
+	if err := markdownRow(w, header); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+	return err
+}
+
+// writeMarkdown writes each table as a GitHub-flavored markdown table,
+// ready to paste into an issue or pull request
+func writeMarkdown(w io.Writer, r *report) error {
+	for i, table := range r.Tables() {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if table.Title != "" {
+			fmt.Fprintf(w, "### %s\n\n", table.Title)
+		}
+		if err := markdownHeader(w, table.Header); err != nil {
+			return err
+		}
+		for _, row := range table.Rows {
+			if err := markdownRow(w, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func streamMarkdown(w io.Writer, r *report, first bool) error {
+	table, err := streamTable(r)
+	if table == nil || err != nil {
+		return err
+	}
+	if first {
+		if err := markdownHeader(w, table.Header); err != nil {
+			return err
+		}
+	}
+	for _, row := range table.Rows {
+		if err := markdownRow(w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// htmlStyle keeps the html report self-contained
+const htmlStyle = `body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 10px; text-align: left; font-size: 0.9em; }
+th { background: #f6f8fa; }
+tr:nth-child(even) td { background: #fafbfc; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+footer { color: #57606a; font-size: 0.8em; }`
+
+// writeHTML writes a standalone HTML page holding every table
+func writeHTML(w io.Writer, r *report) error {
+	title := r.Title
+	if title == "" {
+		title = "filer report"
+	}
+	
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", html.EscapeString(title), htmlStyle)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(title))
+	
+	for _, table := range r.Tables() {
+		if table.Title != "" {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", html.EscapeString(table.Title))
+		}
+		b.WriteString("<table>\n<thead><tr>")
+		for _, cell := range table.Header {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(cell))
+		}
+		b.WriteString("</tr></thead>\n<tbody>\n")
+		for _, row := range table.Rows {
+			b.WriteString("<tr>")
+			for _, cell := range row {
+				if isNumeric(cell) {
+					fmt.Fprintf(&b, "<td class=\"num\">%s</td>", html.EscapeString(cell))
+				} else {
+					fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(cell))
+				}
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</tbody>\n</table>\n")
+	}
+	
+	fmt.Fprintf(&b, "<footer>Generated by filer %s</footer>\n</body>\n</html>\n", rootCmd.Version)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// isNumeric reports whether a cell holds a plain number, which html
+// right-aligns
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && c != '.' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
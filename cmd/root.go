@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/user/filer/internal/query"
+	"github.com/user/filer/internal/units"
 )
 
 var rootCmd = &cobra.Command{
@@ -24,7 +27,12 @@ func Execute() error {
 func init() {
 	// Global flags
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
-	rootCmd.PersistentFlags().StringP("format", "f", "table", "output format (table, json, csv)")
+	rootCmd.PersistentFlags().StringP("format", "f", "table", "output format (table, tree, json, ndjson, yaml, csv, tsv, markdown, html)")
+	
+	// Reject unknown formats before any command does its work
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		checkError(checkOutputFormat(getOutputFormat()))
+	}
 }
 
 // Helper function to handle errors consistently
@@ -46,3 +54,44 @@ func getOutputFormat() string {
 	format, _ := rootCmd.PersistentFlags().GetString("format")
 	return format
 }
+
+// Helper function to compile a --where expression (nil when empty)
+func compileWhere(expr string) (query.Predicate, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	
+	filter, err := query.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --where expression: %w", err)
+	}
+	return filter, nil
+}
+
+// Helper function to parse a human-friendly size flag such as 10MB or 1.5GiB
+func getSizeFlag(cmd *cobra.Command, name string) (int64, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return 0, nil
+	}
+	
+	size, err := units.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return size, nil
+}
+
+// Helper function to parse a date or relative time flag such as 2024-01-31 or 7d
+func getTimeFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	
+	t, err := units.ParseTime(value, time.Now())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	return t, nil
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/user/filer/internal/fileops"
@@ -13,7 +12,15 @@ var searchCmd = &cobra.Command{
 	Use:   "search [pattern] [directory]",
 	Short: "Search for files matching criteria",
 	Long: `Search for files matching the specified pattern and criteria.
-The pattern can be a glob pattern or simple substring match.
+By default the pattern is a glob matched against file names (a pattern
+without wildcards matches any name containing it). Use --pattern-mode to
+match a ** glob against the relative path (e.g. 'src/**/*_test.go'), an
+RE2 regular expression, or a literal substring. Matching ignores case
+unless --case-sensitive is given.
+Use --content to additionally require that a file's contents contain a
+string (or a regular expression with --content-regex).
+--columns and --template shape the output as for 'filer list'.
+With --sort none, matches are printed as soon as they are found.
 If no directory is specified, the current directory is used.`,
 	Aliases: []string{"find", "f"},
 	Args:    cobra.RangeArgs(1, 2),
@@ -24,14 +31,24 @@ func init() {
 	rootCmd.AddCommand(searchCmd)
 	
 	searchCmd.Flags().StringP("extension", "e", "", "filter by file extension")
-	searchCmd.Flags().Int64P("min-size", "m", 0, "minimum file size in bytes")
-	searchCmd.Flags().Int64P("max-size", "M", 0, "maximum file size in bytes")
-	searchCmd.Flags().StringP("modified-since", "s", "", "modified since date (YYYY-MM-DD)")
-	searchCmd.Flags().StringP("modified-before", "b", "", "modified before date (YYYY-MM-DD)")
+	searchCmd.Flags().StringP("min-size", "m", "", "minimum file size (e.g. 512k, 10MB, 1.5GiB)")
+	searchCmd.Flags().StringP("max-size", "M", "", "maximum file size (e.g. 512k, 10MB, 1.5GiB)")
+	searchCmd.Flags().StringP("modified-since", "s", "", "modified since date, time or age (e.g. 2024-01-31, yesterday, 7d)")
+	searchCmd.Flags().StringP("modified-before", "b", "", "modified before date, time or age (e.g. 2024-01-31, yesterday, 7d)")
 	searchCmd.Flags().BoolP("hidden", "H", false, "include hidden files")
-	searchCmd.Flags().StringP("sort", "S", "name", "sort by: name, size, modified, extension")
+	searchCmd.Flags().StringP("sort", "S", "name", "sort by: name, size, modified, extension, none (print as found)")
 	searchCmd.Flags().BoolP("reverse", "r", false, "reverse sort order")
 	searchCmd.Flags().IntP("limit", "l", 0, "limit number of results (0 = no limit)")
+	searchCmd.Flags().StringP("pattern-mode", "p", fileops.PatternGlob, "pattern mode: glob, path, regex, literal")
+	searchCmd.Flags().Bool("case-sensitive", false, "match the pattern case-sensitively")
+	searchCmd.Flags().String("mime", "", "filter by detected MIME type (e.g. image/*, application/pdf)")
+	searchCmd.Flags().Bool("show-mime", false, "detect and show each file's MIME type")
+	searchCmd.Flags().StringP("where", "w", "", "filter expression, e.g. 'ext in (go,md) and size > 10MiB and age < 7d'")
+	searchCmd.Flags().StringP("content", "c", "", "only match files whose contents contain this text")
+	searchCmd.Flags().Bool("content-regex", false, "treat --content as a regular expression")
+	searchCmd.Flags().BoolP("ignore-case", "i", false, "ignore case when matching contents")
+	searchCmd.Flags().IntP("context", "C", 0, "show N lines of context around content matches")
+	addOutputFlags(searchCmd)
 }
 
 func runSearch(cmd *cobra.Command, args []string) {
@@ -45,32 +62,40 @@ func runSearch(cmd *cobra.Command, args []string) {
 	
 	// Parse flags
 	extension, _ := cmd.Flags().GetString("extension")
-	minSize, _ := cmd.Flags().GetInt64("min-size")
-	maxSize, _ := cmd.Flags().GetInt64("max-size")
-	modifiedSinceStr, _ := cmd.Flags().GetString("modified-since")
-	modifiedBeforeStr, _ := cmd.Flags().GetString("modified-before")
 	includeHidden, _ := cmd.Flags().GetBool("hidden")
 	sortBy, _ := cmd.Flags().GetString("sort")
 	reverse, _ := cmd.Flags().GetBool("reverse")
 	limit, _ := cmd.Flags().GetInt("limit")
+	patternMode, _ := cmd.Flags().GetString("pattern-mode")
+	caseSensitive, _ := cmd.Flags().GetBool("case-sensitive")
+	mimeType, _ := cmd.Flags().GetString("mime")
+	showMime, _ := cmd.Flags().GetBool("show-mime")
+	where, _ := cmd.Flags().GetString("where")
+	content, _ := cmd.Flags().GetString("content")
+	contentRegex, _ := cmd.Flags().GetBool("content-regex")
+	ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
+	contextLines, _ := cmd.Flags().GetInt("context")
 	
-	// Parse dates
-	var modifiedSince, modifiedBefore time.Time
-	var err error
-	
-	if modifiedSinceStr != "" {
-		modifiedSince, err = time.Parse("2006-01-02", modifiedSinceStr)
-		checkError(err)
-	}
+	// Parse sizes and dates
+	minSize, err := getSizeFlag(cmd, "min-size")
+	checkError(err)
+	maxSize, err := getSizeFlag(cmd, "max-size")
+	checkError(err)
+	modifiedSince, err := getTimeFlag(cmd, "modified-since")
+	checkError(err)
+	modifiedBefore, err := getTimeFlag(cmd, "modified-before")
+	checkError(err)
 	
-	if modifiedBeforeStr != "" {
-		modifiedBefore, err = time.Parse("2006-01-02", modifiedBeforeStr)
-		checkError(err)
-	}
+	filter, err := compileWhere(where)
+	checkError(err)
+	out, err := getFileOutput(cmd, dir)
+	checkError(err)
 	
 	// Create search options
 	opts := models.SearchOptions{
 		Pattern:        pattern,
+		PatternMode:    patternMode,
+		CaseSensitive:  caseSensitive,
 		Extension:      extension,
 		MinSize:        minSize,
 		MaxSize:        maxSize,
@@ -78,15 +103,33 @@ func runSearch(cmd *cobra.Command, args []string) {
 		ModifiedBefore: modifiedBefore,
 		IncludeHidden:  includeHidden,
 		Recursive:      true,
+		MimeType:       mimeType,
+		Filter:         filter,
+		
+		ContentPattern:    content,
+		ContentRegex:      contentRegex,
+		ContentIgnoreCase: ignoreCase,
+		ContextLines:      contextLines,
 	}
 	
 	// Perform search
 	if isVerbose() {
-		fmt.Printf("Searching for '%s' in '%s'...\n", pattern, dir)
+		notef("Searching for '%s' in '%s'...\n", pattern, dir)
+	}
+	
+	detectMime := showMime || out.hasColumn("mime_type")
+	
+	// Unsorted output is printed as matches are found instead of collected
+	if sortBy == "none" && (out.template != nil || isIncremental()) {
+		streamSearch(dir, opts, out, detectMime, limit)
+		return
 	}
 	
 	files, err := fileops.SearchFiles(dir, opts)
 	checkError(err)
+	if files == nil {
+		files = []*models.FileInfo{}
+	}
 	
 	// Sort results
 	fileops.SortFiles(files, sortBy, reverse)
@@ -96,19 +139,147 @@ func runSearch(cmd *cobra.Command, args []string) {
 		files = files[:limit]
 	}
 	
-	// Output results
-	if len(files) == 0 {
+	if detectMime {
+		fillMimeTypes(files)
+	}
+	
+	// Output results; the other formats write an empty document
+	if len(files) == 0 && isTextFormat() {
 		fmt.Println("No files found matching the criteria")
 		return
 	}
 	
 	if isVerbose() {
-		fmt.Printf("Found %d matching files:\n\n", len(files))
+		notef("Found %d matching files:\n\n", len(files))
 	}
 	
-	outputFiles(files, getOutputFormat())
+	if content != "" && out.template == nil && out.columns == nil {
+		outputContentMatches(dir, files, out)
+	} else {
+		outputFiles(dir, files, out)
+	}
 	
 	if isVerbose() {
-		fmt.Printf("\nSearch completed. Found %d files.\n", len(files))
+		notef("\nSearch completed. Found %d files.\n", len(files))
 	}
 }
+
+func outputContentMatches(dir string, files []*models.FileInfo, out *fileOutput) {
+	render(&report{
+		Title:  fmt.Sprintf("Content matches in %s", dir),
+		Data:   files,
+		Tables: func() []*dataTable { return []*dataTable{contentTable(files)} },
+		Text:   func() { outputContentTable(files) },
+		Tree:   func() { outputTree(dir, files, out) },
+	})
+}
+
+func outputContentTable(files []*models.FileInfo) {
+	totalMatches := 0
+	
+	for i, file := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		printContentMatches(file)
+		totalMatches += file.MatchCount
+	}
+	
+	fmt.Printf("\nTotal: %d matches in %d files\n", totalMatches, len(files))
+}
+
+// printContentMatches prints a file's matching lines grep-style, with their
+// context
+func printContentMatches(file *models.FileInfo) {
+	fmt.Printf("%s (%d matches)\n", file.Path, file.MatchCount)
+	
+	// Context shared by neighbouring matches is printed once, merging
+	// them into one block the way grep -C does
+	last := 0
+	printLine := func(n int, sep string, text string) {
+		if n > last {
+			fmt.Printf("  %6d%s %s\n", n, sep, text)
+			last = n
+		}
+	}
+	
+	for j, match := range file.Matches {
+		first := match.Line - len(match.Before)
+		if j > 0 && first > last+1 && (len(match.Before) > 0 || len(file.Matches[j-1].After) > 0) {
+			fmt.Println("  --")
+		}
+		for k, line := range match.Before {
+			printLine(first+k, "-", line)
+		}
+		printLine(match.Line, ":", match.Text)
+		for k, line := range match.After {
+			n := match.Line + 1 + k
+			if j+1 < len(file.Matches) && n >= file.Matches[j+1].Line {
+				break
+			}
+			printLine(n, "-", line)
+		}
+	}
+}
+
+// streamSearch prints matches as the search finds them, stopping after
+// limit results
+func streamSearch(dir string, opts models.SearchOptions, out *fileOutput, detectMime bool, limit int) {
+	contentMode := opts.ContentPattern != "" && out.template == nil && out.columns == nil
+	stream := newFileStream(out, detectMime)
+	totalMatches := 0
+	
+	err := fileops.SearchFilesFunc(dir, opts, func(file *models.FileInfo) error {
+		if contentMode {
+			first := stream.count == 0
+			stream.count++
+			totalMatches += file.MatchCount
+			renderItem(&report{
+				Data:   file,
+				Tables: func() []*dataTable { return []*dataTable{contentTable([]*models.FileInfo{file})} },
+				Text: func() {
+					if !first {
+						fmt.Println()
+					}
+					printContentMatches(file)
+				},
+			}, first)
+		} else {
+			stream.print(file)
+		}
+		
+		if limit > 0 && stream.count >= limit {
+			return fileops.StopWalk
+		}
+		return nil
+	})
+	checkError(err)
+	
+	if contentMode {
+		switch {
+		case stream.count == 0:
+			render(&report{
+				Data:   []*models.FileInfo{},
+				Tables: func() []*dataTable { return []*dataTable{contentTable(nil)} },
+				Text:   func() { fmt.Println("No files found matching the criteria") },
+			})
+		case getOutputFormat() == "table":
+			fmt.Printf("\nTotal: %d matches in %d files\n", totalMatches, stream.count)
+		}
+		return
+	}
+	stream.finish("No files found matching the criteria")
+}
+
+// contentTable lays out content matches for the tabular formats, one row
+// per matching line
+func contentTable(files []*models.FileInfo) *dataTable {
+	var rows [][]string
+	for _, file := range files {
+		for _, match := range file.Matches {
+			rows = append(rows, []string{file.Path, itoa(match.Line), itoa(file.MatchCount), match.Text})
+		}
+	}
+	
+	return &dataTable{Header: []string{"path", "line", "match_count", "text"}, Rows: rows}
+}
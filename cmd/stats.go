@@ -1,9 +1,8 @@
 package cmd
 
 import (
-        "encoding/json"
         "fmt"
-        "os"
+        "path/filepath"
         "sort"
         "strings"
 
@@ -17,9 +16,10 @@ var statsCmd = &cobra.Command{
         Short: "Show directory statistics and analysis",
         Long: `Display comprehensive statistics about files and directories including:
 - File and directory counts
-- Total size and size distribution
+- Total size, and size and age distributions
 - File type breakdown
 - Largest, oldest, and newest files
+- The largest files and heaviest subdirectories (du-style)
 - Extension analysis
 
 If no directory is specified, the current directory is used.`,
@@ -33,6 +33,11 @@ func init() {
         
         statsCmd.Flags().BoolP("extensions", "e", true, "show file extensions breakdown")
         statsCmd.Flags().IntP("top", "t", 10, "show top N extensions (0 = all)")
+        statsCmd.Flags().Int("top-files", 5, "show the N largest files (0 = none)")
+        statsCmd.Flags().Int("top-dirs", 5, "show the N largest subdirectories by total size (0 = none)")
+        statsCmd.Flags().StringP("sort", "s", "count", "sort extensions by: count, size")
+        statsCmd.Flags().String("table", "summary",
+                "table to write with tabular formats: summary, types, extensions, files, dirs, sizes, ages")
 }
 
 func runStats(cmd *cobra.Command, args []string) {
@@ -45,32 +50,141 @@ func runStats(cmd *cobra.Command, args []string) {
         // Get flags
         showExtensions, _ := cmd.Flags().GetBool("extensions")
         topN, _ := cmd.Flags().GetInt("top")
+        topFiles, _ := cmd.Flags().GetInt("top-files")
+        topDirs, _ := cmd.Flags().GetInt("top-dirs")
+        sortBy, _ := cmd.Flags().GetString("sort")
+        if sortBy != "count" && sortBy != "size" {
+                checkError(fmt.Errorf("invalid --sort %q (expected count or size)", sortBy))
+        }
+        table, _ := cmd.Flags().GetString("table")
+        if !containsString(statsTableNames, table) {
+                checkError(fmt.Errorf("unknown --table %q (expected one of: %s)", table, strings.Join(statsTableNames, ", ")))
+        }
         
         if isVerbose() {
-                fmt.Printf("Analyzing directory: %s\n", dir)
+                notef("Analyzing directory: %s\n", dir)
         }
         
         // Calculate statistics
-        stats, err := fileops.GetDirectoryStats(dir)
+        stats, err := fileops.GetDirectoryStats(dir, models.StatsOptions{
+                TopFiles: topFiles,
+                TopDirs:  topDirs,
+        })
         checkError(err)
         
-        // Output based on format
-        format := getOutputFormat()
-        switch format {
-        case "json":
-                outputStatsJSON(stats)
-        default:
-                outputStatsTable(stats, showExtensions, topN)
+        // Delimited formats default to the summary table so the output is one
+        // CSV document; the others show every table unless one is picked
+        tables := statsTableNames
+        if isDelimited(getOutputFormat()) || cmd.Flags().Changed("table") {
+                tables = []string{table}
         }
+        
+        render(&report{
+                Title: fmt.Sprintf("Directory Statistics for %s", stats.Path),
+                Data:  stats,
+                Tables: func() []*dataTable {
+                        var result []*dataTable
+                        for _, name := range tables {
+                                result = append(result, statsTable(stats, name, sortBy))
+                        }
+                        return result
+                },
+                Text: func() { outputStatsTable(stats, showExtensions, topN, sortBy) },
+        })
 }
 
-func outputStatsJSON(stats *models.DirectoryStats) {
-        encoder := json.NewEncoder(os.Stdout)
-        encoder.SetIndent("", "  ")
-        checkError(encoder.Encode(stats))
+// statsTableNames lists the tables stats can be laid out as, in the order
+// they appear in reports
+var statsTableNames = []string{"summary", "types", "extensions", "files", "dirs", "sizes", "ages"}
+
+// statsTable lays out one part of the statistics for the tabular formats
+func statsTable(stats *models.DirectoryStats, name, sortBy string) *dataTable {
+        var title string
+        var header []string
+        var rows [][]string
+        
+        switch name {
+        case "summary":
+                title = "Summary"
+                header = []string{"path", "total_files", "total_dirs", "total_size", "average_size",
+                        "largest_file", "largest_size", "oldest_file", "oldest_modified", "newest_file", "newest_modified"}
+                var average int64
+                if stats.TotalFiles > 0 {
+                        average = stats.TotalSize / int64(stats.TotalFiles)
+                }
+                row := []string{stats.Path, itoa(stats.TotalFiles), itoa(stats.TotalDirs), int64toa(stats.TotalSize), int64toa(average)}
+                if stats.LargestFile != nil {
+                        row = append(row, stats.LargestFile.Path, int64toa(stats.LargestFile.Size))
+                } else {
+                        row = append(row, "", "")
+                }
+                for _, file := range []*models.FileInfo{stats.OldestFile, stats.NewestFile} {
+                        if file != nil {
+                                row = append(row, file.Path, file.ModTime.Format("2006-01-02 15:04:05"))
+                        } else {
+                                row = append(row, "", "")
+                        }
+                }
+                rows = append(rows, row)
+                
+        case "types":
+                title = "File Types"
+                header = []string{"category", "count", "size", "percent_size"}
+                for category, fileType := range stats.FileTypes {
+                        rows = append(rows, []string{category, itoa(fileType.Count), int64toa(fileType.Size),
+                                fmt.Sprintf("%.1f", percentOf(fileType.Size, stats.TotalSize))})
+                }
+                sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+                
+        case "extensions":
+                title = "File Extensions"
+                header = []string{"extension", "count", "percent_count", "size", "percent_size",
+                        "average_size", "largest_file", "largest_size"}
+                for _, name := range sortedExtensions(stats, sortBy) {
+                        ext := stats.Extensions[name]
+                        rows = append(rows, []string{
+                                name,
+                                itoa(ext.Count),
+                                fmt.Sprintf("%.1f", percentOf(int64(ext.Count), int64(stats.TotalFiles))),
+                                int64toa(ext.Size),
+                                fmt.Sprintf("%.1f", percentOf(ext.Size, stats.TotalSize)),
+                                int64toa(ext.AverageSize),
+                                ext.LargestFile,
+                                int64toa(ext.LargestSize),
+                        })
+                }
+                
+        case "files":
+                title = "Largest Files"
+                header = []string{"rank", "path", "size", "modified"}
+                for i, file := range stats.LargestFiles {
+                        rows = append(rows, []string{itoa(i + 1), file.Path, int64toa(file.Size), file.ModTime.Format("2006-01-02 15:04:05")})
+                }
+                
+        case "dirs":
+                title = "Largest Directories"
+                header = []string{"rank", "path", "files", "size"}
+                for i, dir := range stats.LargestDirs {
+                        rows = append(rows, []string{itoa(i + 1), dir.Path, itoa(dir.Files), int64toa(dir.Size)})
+                }
+                
+        case "sizes", "ages":
+                histogram := stats.SizeHistogram
+                title = "Size Distribution"
+                if name == "ages" {
+                        title, histogram = "Age Distribution", stats.AgeHistogram
+                }
+                header = []string{"bucket", "count", "size"}
+                for _, b := range histogram {
+                        rows = append(rows, []string{b.Label, itoa(b.Count), int64toa(b.Size)})
+                }
+                
+        }
+        
+        return &dataTable{Title: title, Header: header, Rows: rows}
 }
 
-func outputStatsTable(stats *models.DirectoryStats, showExtensions bool, topN int) {
+func outputStatsTable(stats *models.DirectoryStats, showExtensions bool, topN int, sortBy string) {
         fmt.Printf("Directory Statistics for: %s\n", stats.Path)
         fmt.Println(strings.Repeat("=", 60))
         
@@ -104,25 +218,64 @@ func outputStatsTable(stats *models.DirectoryStats, showExtensions bool, topN in
                         stats.NewestFile.ModTime.Format("2006-01-02"))
         }
         
-        // Extensions breakdown
-        if showExtensions && len(stats.Extensions) > 0 {
-                fmt.Printf("\nFile Extensions:\n")
+        // Largest files and directories
+        if len(stats.LargestFiles) > 0 {
+                fmt.Printf("\nLargest Files:\n")
+                fmt.Println(strings.Repeat("-", 30))
+                for i, file := range stats.LargestFiles {
+                        fmt.Printf("%2d. %10s  %s\n", i+1, file.SizeHuman, file.Path)
+                }
+        }
+        
+        if len(stats.LargestDirs) > 0 {
+                fmt.Printf("\nLargest Directories:\n")
+                fmt.Println(strings.Repeat("-", 30))
+                for i, dir := range stats.LargestDirs {
+                        fmt.Printf("%2d. %10s  %s/ (%d files)\n", i+1, dir.SizeHuman, dir.Path, dir.Files)
+                }
+        }
+        
+        // Distributions
+        if stats.TotalFiles > 0 {
+                fmt.Printf("\nSize Distribution:\n")
                 fmt.Println(strings.Repeat("-", 30))
+                printHistogram(stats.SizeHistogram)
                 
-                // Sort extensions by count
-                type extCount struct {
-                        ext   string
-                        count int
+                fmt.Printf("\nAge Distribution:\n")
+                fmt.Println(strings.Repeat("-", 30))
+                printHistogram(stats.AgeHistogram)
+        }
+        
+        // Category breakdown
+        if len(stats.FileTypes) > 0 {
+                fmt.Printf("\nFile Types:\n")
+                fmt.Println(strings.Repeat("-", 30))
+                
+                categories := make([]string, 0, len(stats.FileTypes))
+                for category := range stats.FileTypes {
+                        categories = append(categories, category)
                 }
+                sort.Slice(categories, func(i, j int) bool {
+                        a, b := stats.FileTypes[categories[i]], stats.FileTypes[categories[j]]
+                        if a.Size != b.Size {
+                                return a.Size > b.Size
+                        }
+                        return categories[i] < categories[j]
+                })
                 
-                var extensions []extCount
-                for ext, count := range stats.Extensions {
-                        extensions = append(extensions, extCount{ext, count})
+                for _, category := range categories {
+                        fileType := stats.FileTypes[category]
+                        fmt.Printf("%-10s %4d files %10s (%.1f%%)\n",
+                                category, fileType.Count, fileType.SizeHuman, percentOf(fileType.Size, stats.TotalSize))
                 }
+        }
+        
+        // Extensions breakdown
+        if showExtensions && len(stats.Extensions) > 0 {
+                fmt.Printf("\nFile Extensions:\n")
+                fmt.Println(strings.Repeat("-", 30))
                 
-                sort.Slice(extensions, func(i, j int) bool {
-                        return extensions[i].count > extensions[j].count
-                })
+                extensions := sortedExtensions(stats, sortBy)
                 
                 // Show top N or all
                 maxShow := len(extensions)
@@ -130,18 +283,27 @@ func outputStatsTable(stats *models.DirectoryStats, showExtensions bool, topN in
                         maxShow = topN
                 }
                 
-                for i := 0; i < maxShow; i++ {
-                        ext := extensions[i]
-                        percentage := float64(ext.count) / float64(stats.TotalFiles) * 100
-                        fmt.Printf("%-8s %4d files (%.1f%%)\n", "."+ext.ext, ext.count, percentage)
+                for _, name := range extensions[:maxShow] {
+                        ext := stats.Extensions[name]
+                        fmt.Printf("%-10s %4d files (%5.1f%%) %10s (%5.1f%%)  avg %s, largest %s (%s)\n",
+                                "."+name,
+                                ext.Count, percentOf(int64(ext.Count), int64(stats.TotalFiles)),
+                                ext.SizeHuman, percentOf(ext.Size, stats.TotalSize),
+                                ext.AverageHuman,
+                                filepath.Base(ext.LargestFile), formatBytes(ext.LargestSize))
                 }
                 
-                if topN > 0 && len(extensions) > topN {
-                        remaining := 0
-                        for i := topN; i < len(extensions); i++ {
-                                remaining += extensions[i].count
+                if len(extensions) > maxShow {
+                        var remaining int
+                        var remainingSize int64
+                        for _, name := range extensions[maxShow:] {
+                                remaining += stats.Extensions[name].Count
+                                remainingSize += stats.Extensions[name].Size
                         }
-                        fmt.Printf("%-8s %4d files (others)\n", "...", remaining)
+                        fmt.Printf("%-10s %4d files (%5.1f%%) %10s (%5.1f%%)  (others)\n",
+                                "...",
+                                remaining, percentOf(int64(remaining), int64(stats.TotalFiles)),
+                                formatBytes(remainingSize), percentOf(remainingSize, stats.TotalSize))
                 }
         }
         
@@ -153,6 +315,71 @@ func outputStatsTable(stats *models.DirectoryStats, showExtensions bool, topN in
                 stats.TotalSizeHuman)
 }
 
+// sortedExtensions returns the extensions in stats ordered by count or
+// size, largest first
+func sortedExtensions(stats *models.DirectoryStats, sortBy string) []string {
+        extensions := make([]string, 0, len(stats.Extensions))
+        for ext := range stats.Extensions {
+                extensions = append(extensions, ext)
+        }
+        
+        sort.Slice(extensions, func(i, j int) bool {
+                a, b := stats.Extensions[extensions[i]], stats.Extensions[extensions[j]]
+                if sortBy == "size" && a.Size != b.Size {
+                        return a.Size > b.Size
+                }
+                if a.Count != b.Count {
+                        return a.Count > b.Count
+                }
+                return extensions[i] < extensions[j]
+        })
+        return extensions
+}
+
+// histogramWidth is the length of the longest bar in a histogram
+const histogramWidth = 40
+
+// printHistogram draws a histogram as horizontal bars scaled to its
+// fullest bucket
+func printHistogram(histogram []models.HistogramBucket) {
+        maxCount := 0
+        for _, b := range histogram {
+                if b.Count > maxCount {
+                        maxCount = b.Count
+                }
+        }
+        
+        for _, b := range histogram {
+                bar := 0
+                if maxCount > 0 {
+                        bar = b.Count * histogramWidth / maxCount
+                }
+                // Non-empty buckets always get at least a sliver
+                if bar == 0 && b.Count > 0 {
+                        bar = 1
+                }
+                fmt.Printf("%-6s %5d %10s |%s\n", b.Label, b.Count, formatBytes(b.Size), strings.Repeat("#", bar))
+        }
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+        for _, item := range list {
+                if item == s {
+                        return true
+                }
+        }
+        return false
+}
+
+// percentOf returns part as a percentage of total, or 0 for an empty total
+func percentOf(part, total int64) float64 {
+        if total == 0 {
+                return 0
+        }
+        return float64(part) / float64(total) * 100
+}
+
 func formatBytes(bytes int64) string {
         const unit = 1024
         if bytes < unit {
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/filer/internal/fileops"
+	"github.com/user/filer/internal/models"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [directory]",
+	Short: "Undo the last organize run",
+	Long: `Undo the most recent organize run in the specified directory by replaying
+its journal in reverse. Files that changed since they were organized are
+left in place unless --force is given, and category directories created by
+the run are removed if they are empty.
+
+Files replaced by organize --conflict overwrite or keep-newer are kept
+under hidden .filer-overwritten-* names until the runs are committed with
+--commit, which deletes them and clears every organize run from the
+journal so it can no longer be undone.
+If no directory is specified, the current directory is used.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runUndo,
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	
+	undoCmd.Flags().BoolP("dry-run", "n", false, "show what would be undone without making changes")
+	undoCmd.Flags().BoolP("confirm", "y", false, "skip confirmation prompt")
+	undoCmd.Flags().Bool("force", false, "restore files even if they changed since organize")
+	undoCmd.Flags().Bool("commit", false, "keep every organize run: delete the files kept from overwrites and clear the journal")
+}
+
+func runUndo(cmd *cobra.Command, args []string) {
+	// Get directory to restore
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	
+	// Get flags
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	skipConfirm, _ := cmd.Flags().GetBool("confirm")
+	force, _ := cmd.Flags().GetBool("force")
+	commit, _ := cmd.Flags().GetBool("commit")
+	
+	apply, preview, done := fileops.UndoOrganize, "The last organize run will be undone as follows:", "Undo results:"
+	if commit {
+		apply, preview, done = fileops.CommitOrganize, "Organize runs will be committed as follows:", "Commit results:"
+	}
+	
+	opts := models.UndoOptions{DryRun: true, Force: force}
+	
+	// Plan first to show a preview
+	planned, err := apply(dir, opts)
+	checkError(err)
+	
+	if dryRun || !skipConfirm {
+		outputUndoResults(planned, preview)
+	}
+	
+	if dryRun {
+		notef("\n(This was a dry run - no files were changed)\n")
+		return
+	}
+	
+	// Confirm unless skip flag is set
+	if !skipConfirm {
+		if commit {
+			notef("\nProceed with commit? Organize runs cannot be undone afterwards (y/N): ")
+		} else {
+			notef("\nProceed with undo? (y/N): ")
+		}
+		var response string
+		fmt.Scanln(&response)
+		
+		if strings.ToLower(response) != "y" && strings.ToLower(response) != "yes" {
+			notef("Undo cancelled\n")
+			return
+		}
+	}
+	
+	opts.DryRun = false
+	results, err := apply(dir, opts)
+	outputUndoResults(results, done)
+	checkError(err)
+}
+
+func outputUndoResults(results []*models.UndoResult, title string) {
+	render(&report{
+		Title: title,
+		Data:  results,
+		Tables: func() []*dataTable {
+			rows := make([][]string, 0, len(results))
+			for _, result := range results {
+				rows = append(rows, []string{result.Action, result.Path, result.From, result.Reason})
+			}
+			return []*dataTable{{Header: []string{"action", "path", "from", "reason"}, Rows: rows}}
+		},
+		Text: func() { outputUndoTable(results, title) },
+	})
+}
+
+func outputUndoTable(results []*models.UndoResult, title string) {
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", 50))
+	
+	restored, deleted, skipped := 0, 0, 0
+	for _, result := range results {
+		line := result.Path
+		if result.From != "" {
+			line = result.From + " -> " + result.Path
+		}
+		if result.Reason != "" {
+			line += " (" + result.Reason + ")"
+		}
+		fmt.Printf("  %-8s %s\n", result.Action, line)
+		
+		switch result.Action {
+		case "restore":
+			restored++
+		case "delete":
+			deleted++
+		case "skip":
+			skipped++
+		}
+	}
+	
+	if deleted > 0 {
+		fmt.Printf("\nTotal: %d replaced files to delete, %d skipped\n", deleted, skipped)
+		return
+	}
+	fmt.Printf("\nTotal: %d files to restore, %d skipped\n", restored, skipped)
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/filer/internal/fileops"
+	"github.com/user/filer/internal/models"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [directory]",
+	Short: "Stream filesystem changes in a directory tree",
+	Long: `Watch a directory tree and print create, modify, delete and rename
+events as they happen, until interrupted. Events can be filtered by
+extension, name pattern and hidden files like search. With --format json
+each event is printed as one JSON object per line (NDJSON), ready to be
+piped into other tools.
+If no directory is specified, the current directory is used.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	
+	watchCmd.Flags().StringP("pattern", "P", "", "only report paths matching this pattern")
+	watchCmd.Flags().StringP("pattern-mode", "p", fileops.PatternGlob, "pattern mode: glob, path, regex, literal")
+	watchCmd.Flags().Bool("case-sensitive", false, "match the pattern case-sensitively")
+	watchCmd.Flags().StringP("extension", "e", "", "filter by file extension")
+	watchCmd.Flags().BoolP("hidden", "H", false, "include hidden files")
+	watchCmd.Flags().BoolP("recursive", "r", true, "watch subdirectories too")
+	watchCmd.Flags().Bool("poll", false, "poll for changes instead of using inotify")
+	watchCmd.Flags().Duration("interval", time.Second, "polling interval")
+}
+
+func runWatch(cmd *cobra.Command, args []string) {
+	// Get directory to watch
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	
+	// Parse flags
+	pattern, _ := cmd.Flags().GetString("pattern")
+	patternMode, _ := cmd.Flags().GetString("pattern-mode")
+	caseSensitive, _ := cmd.Flags().GetBool("case-sensitive")
+	extension, _ := cmd.Flags().GetString("extension")
+	includeHidden, _ := cmd.Flags().GetBool("hidden")
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	poll, _ := cmd.Flags().GetBool("poll")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	
+	filter, err := fileops.NewEventFilter(dir, models.SearchOptions{
+		Pattern:       pattern,
+		PatternMode:   patternMode,
+		CaseSensitive: caseSensitive,
+		Extension:     extension,
+	})
+	checkError(err)
+	
+	// Fail before watching when the format cannot be streamed
+	checkError(checkStreamFormat(getOutputFormat()))
+	
+	watcher, err := fileops.NewWatcher(dir, fileops.WatchOptions{
+		Recursive:     recursive,
+		IncludeHidden: includeHidden,
+		ForcePolling:  poll,
+		PollInterval:  interval,
+	})
+	checkError(err)
+	defer watcher.Close()
+	
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	
+	if isVerbose() {
+		fmt.Fprintf(os.Stderr, "Watching '%s' (%s). Press Ctrl+C to stop.\n", dir, watcher.Backend)
+	}
+	
+	first := true
+	
+	for {
+		select {
+		case <-interrupt:
+			return
+			
+		case err, ok := <-watcher.Errors:
+			if ok {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !filter(event) {
+				continue
+			}
+			
+			renderItem(&report{
+				Data: event,
+				Tables: func() []*dataTable {
+					return []*dataTable{{
+						Header: []string{"time", "op", "path", "old_path", "is_dir"},
+						Rows: [][]string{{
+							event.Time.Format(time.RFC3339Nano), event.Op, event.Path, event.OldPath, btoa(event.IsDir),
+						}},
+					}}
+				},
+				Text: func() { outputWatchEvent(event) },
+			}, first)
+			first = false
+		}
+	}
+}
+
+func outputWatchEvent(event models.WatchEvent) {
+	path := event.Path
+	if event.OldPath != "" {
+		path = event.OldPath + " -> " + event.Path
+	}
+	if event.IsDir {
+		path += "/"
+	}
+	
+	fmt.Printf("%s  %-7s %s\n", event.Time.Format("2006-01-02 15:04:05"), event.Op, path)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// YAML output is produced by re-encoding the JSON form of a value, so it
+// follows the same field names and order as the json format
+
+// yamlNode is a decoded JSON value: a scalar already rendered as YAML, a
+// mapping (keys and values) or a sequence (items)
+type yamlNode struct {
+	scalar string
+	keys   []string
+	values []*yamlNode
+	items  []*yamlNode
+	isMap  bool
+	isSeq  bool
+}
+
+// writeYAML writes v as a YAML document
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := readYAMLNode(decoder)
+	if err != nil {
+		return err
+	}
+	
+	var b strings.Builder
+	if node.isMap && len(node.keys) > 0 || node.isSeq && len(node.items) > 0 {
+		emitYAML(&b, node, "")
+	} else {
+		b.WriteString(yamlInline(node) + "\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// readYAMLNode reads one complete value from the JSON token stream
+func readYAMLNode(decoder *json.Decoder) (*yamlNode, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			node := &yamlNode{isMap: true}
+			for decoder.More() {
+				keyTok, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := readYAMLNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, yamlString(keyTok.(string)))
+				node.values = append(node.values, value)
+			}
+			_, err := decoder.Token()
+			return node, err
+		}
+		
+		node := &yamlNode{isSeq: true}
+		for decoder.More() {
+			item, err := readYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		_, err := decoder.Token()
+		return node, err
+		
+	case string:
+		return &yamlNode{scalar: yamlString(t)}, nil
+	case json.Number:
+		return &yamlNode{scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{scalar: fmt.Sprint(t)}, nil
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// yamlInline renders scalars and empty collections, which fit on one line
+func yamlInline(node *yamlNode) string {
+	switch {
+	case node.isMap:
+		return "{}"
+	case node.isSeq:
+		return "[]"
+	}
+	return node.scalar
+}
+
+// isBlock reports whether a node needs lines of its own
+func isBlock(node *yamlNode) bool {
+	return node.isMap && len(node.keys) > 0 || node.isSeq && len(node.items) > 0
+}
+
+// emitYAML writes a non-empty mapping or sequence in block style, each line
+// starting with indent
+func emitYAML(b *strings.Builder, node *yamlNode, indent string) {
+	if node.isMap {
+		for i, key := range node.keys {
+			value := node.values[i]
+			if !isBlock(value) {
+				fmt.Fprintf(b, "%s%s: %s\n", indent, key, yamlInline(value))
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", indent, key)
+			emitYAML(b, value, indent+"  ")
+		}
+		return
+	}
+	
+	for _, item := range node.items {
+		if !isBlock(item) {
+			fmt.Fprintf(b, "%s- %s\n", indent, yamlInline(item))
+			continue
+		}
+		
+		// The item's first line shares the line with the dash
+		var nested strings.Builder
+		emitYAML(&nested, item, indent+"  ")
+		fmt.Fprintf(b, "%s- %s", indent, strings.TrimPrefix(nested.String(), indent+"  "))
+	}
+}
+
+// yamlPlain matches strings that are safe to write unquoted
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_/.][A-Za-z0-9_./+@-]*( [A-Za-z0-9_./+@()-]+)*$`)
+
+// yamlReserved are plain words YAML would read as something other than a
+// string
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true, ".inf": true, ".nan": true,
+}
+
+// yamlString renders a string scalar, quoting it when it would otherwise be
+// misread. JSON string escapes are also valid in YAML double quotes.
+func yamlString(s string) string {
+	if yamlPlain.MatchString(s) && !yamlReserved[strings.ToLower(s)] {
+		return s
+	}
+	
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
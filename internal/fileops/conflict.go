@@ -0,0 +1,179 @@
+package fileops
+
+import (
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+// Conflict policies for moves whose destination already exists
+const (
+        ConflictSkip          = "skip"
+        ConflictRename        = "rename"
+        ConflictOverwrite     = "overwrite"
+        ConflictKeepNewer     = "keep-newer"
+        ConflictSkipIdentical = "skip-if-identical"
+)
+
+// ConflictPolicies lists the supported conflict policies
+var ConflictPolicies = []string{ConflictSkip, ConflictRename, ConflictOverwrite, ConflictKeepNewer, ConflictSkipIdentical}
+
+// Actions reported for each organized file
+const (
+        ActionMove      = "move"
+        ActionRename    = "rename"
+        ActionOverwrite = "overwrite"
+        ActionSkip      = "skip"
+)
+
+// planMove decides how a file is moved to target under a conflict policy.
+// claimed holds destinations already taken by earlier files in the same
+// run; the chosen destination is added to it. An empty policy means rename.
+func planMove(file *models.FileInfo, target, policy string, claimed map[string]bool) (*models.OrganizeEntry, error) {
+        entry := &models.OrganizeEntry{
+                Name:   file.Name,
+                Source: file.Path,
+                Target: target,
+                Action: ActionMove,
+        }
+
+        switch policy {
+        case "":
+                policy = ConflictRename
+        case ConflictSkip, ConflictRename, ConflictOverwrite, ConflictKeepNewer, ConflictSkipIdentical:
+        default:
+                return nil, fmt.Errorf("unknown conflict policy %q (expected one of: %s)",
+                        policy, strings.Join(ConflictPolicies, ", "))
+        }
+
+        existing, statErr := os.Stat(target)
+
+        switch {
+        case filepath.Clean(target) == filepath.Clean(file.Path):
+                entry.Action, entry.Reason = ActionSkip, "already in place"
+
+        case claimed[target]:
+                // Another file in this run is headed here; never overwrite it
+                if policy == ConflictSkip {
+                        entry.Action, entry.Reason = ActionSkip, "another file has the same destination"
+                } else {
+                        entry.Action, entry.Reason = ActionRename, "another file has the same destination"
+                        entry.Target = uniqueTarget(target, claimed)
+                }
+
+        case statErr != nil:
+                // Nothing at the destination
+
+        case existing.IsDir():
+                // A directory is never replaced, whatever the policy
+                if policy == ConflictSkip {
+                        entry.Action, entry.Reason = ActionSkip, "a directory has the target name"
+                } else {
+                        entry.Action, entry.Reason = ActionRename, "a directory has the target name"
+                        entry.Target = uniqueTarget(target, claimed)
+                }
+
+        case policy == ConflictSkip:
+                entry.Action, entry.Reason = ActionSkip, "target exists"
+
+        case policy == ConflictRename:
+                entry.Action, entry.Reason = ActionRename, "target exists"
+                entry.Target = uniqueTarget(target, claimed)
+
+        case policy == ConflictOverwrite:
+                entry.Action, entry.Reason = ActionOverwrite, "target exists"
+
+        case policy == ConflictKeepNewer:
+                if file.ModTime.After(existing.ModTime()) {
+                        entry.Action, entry.Reason = ActionOverwrite, "source is newer"
+                } else {
+                        entry.Action, entry.Reason = ActionSkip, "existing file is not older"
+                }
+
+        case policy == ConflictSkipIdentical:
+                identical, err := sameContents(file.Path, target, file.Size, existing.Size())
+                if err != nil {
+                        return nil, err
+                }
+                if identical {
+                        entry.Action, entry.Reason = ActionSkip, "identical file exists"
+                } else {
+                        entry.Action, entry.Reason = ActionRename, "different file exists"
+                        entry.Target = uniqueTarget(target, claimed)
+                }
+        }
+
+        if entry.Action != ActionSkip {
+                claimed[entry.Target] = true
+        }
+        return entry, nil
+}
+
+// setAside moves the file about to be overwritten at target to a hidden
+// name beside it and journals the move, so undo can put it back once the
+// file that replaced it has been moved out again. It returns the hidden
+// name, or "" when target no longer exists.
+func setAside(target string, journal *Journal) (string, error) {
+        info, err := os.Lstat(target)
+        if os.IsNotExist(err) {
+                return "", nil
+        }
+        if err != nil {
+                return "", err
+        }
+
+        // A run may overwrite the same file more than once (e.g. under --watch)
+        backup := filepath.Join(filepath.Dir(target), fmt.Sprintf(".filer-overwritten-%s-%s", journal.run, filepath.Base(target)))
+        if _, err := os.Lstat(backup); err == nil {
+                backup = uniqueTarget(backup, nil)
+        }
+        if err := os.Rename(target, backup); err != nil {
+                return "", err
+        }
+
+        modTime := info.ModTime()
+        return backup, journal.Record(models.JournalEntry{
+                Op:      OpOverwrite,
+                Path:    target,
+                Target:  backup,
+                Size:    info.Size(),
+                ModTime: &modTime,
+        })
+}
+
+// uniqueTarget returns the first free variant of target with a numeric
+// suffix, e.g. photo_1.jpg
+func uniqueTarget(target string, claimed map[string]bool) string {
+        ext := filepath.Ext(target)
+        base := strings.TrimSuffix(target, ext)
+
+        for i := 1; ; i++ {
+                candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+                if claimed[candidate] {
+                        continue
+                }
+                if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+                        return candidate
+                }
+        }
+}
+
+// sameContents reports whether two files have identical contents
+func sameContents(a, b string, sizeA, sizeB int64) (bool, error) {
+        if sizeA != sizeB {
+                return false, nil
+        }
+
+        hashA, err := HashFile(a, 0)
+        if err != nil {
+                return false, err
+        }
+        hashB, err := HashFile(b, 0)
+        if err != nil {
+                return false, err
+        }
+        return hashA == hashB, nil
+}
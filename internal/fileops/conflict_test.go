@@ -0,0 +1,208 @@
+package fileops
+
+import (
+        "os"
+        "path/filepath"
+        "strings"
+        "testing"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+func TestPlanMove(t *testing.T) {
+        now := time.Now()
+        older, newer := now.Add(-time.Hour), now.Add(time.Hour)
+
+        tests := []struct {
+                policy   string
+                existing string    // contents at the target; "" for none, "/" for a directory
+                modTime  time.Time // of the existing target
+                claimed  bool      // another file in the run already took the target
+                action   string
+                renamed  bool
+        }{
+                // Nothing in the way
+                {ConflictSkip, "", now, false, ActionMove, false},
+                {ConflictOverwrite, "", now, false, ActionMove, false},
+
+                {ConflictSkip, "other", now, false, ActionSkip, false},
+                {ConflictRename, "other", now, false, ActionRename, true},
+                {"", "other", now, false, ActionRename, true},
+                {ConflictOverwrite, "other", now, false, ActionOverwrite, false},
+                {ConflictKeepNewer, "other", older, false, ActionOverwrite, false},
+                {ConflictKeepNewer, "other", newer, false, ActionSkip, false},
+                {ConflictKeepNewer, "other", now, false, ActionSkip, false},
+                {ConflictSkipIdentical, "source", now, false, ActionSkip, false},
+                {ConflictSkipIdentical, "other!", now, false, ActionRename, true},
+
+                // A directory is never replaced
+                {ConflictSkip, "/", now, false, ActionSkip, false},
+                {ConflictOverwrite, "/", now, false, ActionRename, true},
+                {ConflictKeepNewer, "/", older, false, ActionRename, true},
+
+                // Neither is a file moved earlier in the same run
+                {ConflictSkip, "", now, true, ActionSkip, false},
+                {ConflictOverwrite, "", now, true, ActionRename, true},
+                {ConflictSkipIdentical, "source", now, true, ActionRename, true},
+        }
+
+        for _, tt := range tests {
+                name := tt.policy + "/" + tt.existing
+                dir := t.TempDir()
+                src, target := filepath.Join(dir, "in", "a.txt"), filepath.Join(dir, "out", "a.txt")
+                writeFile(t, src, "source", now)
+                file := models.NewFileInfo(src, mustStat(t, src))
+
+                switch tt.existing {
+                case "":
+                        os.MkdirAll(filepath.Dir(target), 0755)
+                case "/":
+                        if err := os.MkdirAll(target, 0755); err != nil {
+                                t.Fatal(err)
+                        }
+                default:
+                        writeFile(t, target, tt.existing, tt.modTime)
+                }
+
+                claimed := map[string]bool{}
+                if tt.claimed {
+                        claimed[target] = true
+                }
+
+                entry, err := planMove(file, target, tt.policy, claimed)
+                if err != nil {
+                        t.Errorf("%s: %v", name, err)
+                        continue
+                }
+                if entry.Action != tt.action {
+                        t.Errorf("%s: got action %s (%s), want %s", name, entry.Action, entry.Reason, tt.action)
+                }
+
+                wantTarget := target
+                if tt.renamed {
+                        wantTarget = filepath.Join(dir, "out", "a_1.txt")
+                }
+                if entry.Target != wantTarget {
+                        t.Errorf("%s: got target %s, want %s", name, entry.Target, wantTarget)
+                }
+                if claimed[entry.Target] != (tt.claimed || tt.action != ActionSkip) {
+                        t.Errorf("%s: target %s claimed = %v", name, entry.Target, claimed[entry.Target])
+                }
+        }
+}
+
+func TestPlanMoveInPlace(t *testing.T) {
+        dir := t.TempDir()
+        path := filepath.Join(dir, "a.txt")
+        writeFile(t, path, "source", time.Now())
+
+        entry, err := planMove(models.NewFileInfo(path, mustStat(t, path)), path, ConflictOverwrite, map[string]bool{})
+        if err != nil {
+                t.Fatal(err)
+        }
+        if entry.Action != ActionSkip || entry.Reason != "already in place" {
+                t.Errorf("got %s (%s), want a skip", entry.Action, entry.Reason)
+        }
+}
+
+func TestPlanMoveUnknownPolicy(t *testing.T) {
+        dir := t.TempDir()
+        path := filepath.Join(dir, "a.txt")
+        writeFile(t, path, "source", time.Now())
+
+        _, err := planMove(models.NewFileInfo(path, mustStat(t, path)), filepath.Join(dir, "b.txt"), "replace", map[string]bool{})
+        if err == nil || !strings.Contains(err.Error(), "unknown conflict policy") {
+                t.Errorf("got error %v, want an unknown policy error", err)
+        }
+}
+
+func TestUndoOverwrite(t *testing.T) {
+        dir := t.TempDir()
+        replaced := filepath.Join(dir, "documents", "notes.txt")
+        writeFile(t, replaced, "old notes", time.Now().Add(-time.Hour))
+        writeFile(t, filepath.Join(dir, "notes.txt"), "new notes", time.Now())
+
+        organized := organize(t, dir, ConflictOverwrite)
+        entry := organized["documents"][0]
+        if entry.Action != ActionOverwrite || entry.Backup == "" {
+                t.Fatalf("got entry %+v, want an overwrite with a backup", entry)
+        }
+        if got := readFile(t, replaced); got != "new notes" {
+                t.Errorf("target holds %q after the overwrite", got)
+        }
+        if got := readFile(t, entry.Backup); got != "old notes" {
+                t.Errorf("backup holds %q", got)
+        }
+
+        undo(t, dir)
+
+        if got := readFile(t, filepath.Join(dir, "notes.txt")); got != "new notes" {
+                t.Errorf("moved file holds %q after undo", got)
+        }
+        if got := readFile(t, replaced); got != "old notes" {
+                t.Errorf("overwritten file holds %q after undo", got)
+        }
+        if _, err := os.Lstat(entry.Backup); !os.IsNotExist(err) {
+                t.Error("backup still exists after undo")
+        }
+}
+
+func TestCommitOrganize(t *testing.T) {
+        dir := t.TempDir()
+        replaced := filepath.Join(dir, "documents", "notes.txt")
+        writeFile(t, replaced, "old notes", time.Now().Add(-time.Hour))
+        writeFile(t, filepath.Join(dir, "notes.txt"), "new notes", time.Now())
+        backup := organize(t, dir, ConflictOverwrite)["documents"][0].Backup
+
+        // Entries from other commands survive the commit
+        journal, err := OpenJournal(filepath.Join(dir, JournalName))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if err := journal.Record(models.JournalEntry{Op: DedupeDelete, Path: filepath.Join(dir, "dup.txt")}); err != nil {
+                t.Fatal(err)
+        }
+        journal.Close()
+
+        preview, err := CommitOrganize(dir, models.UndoOptions{DryRun: true})
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(preview) != 1 || preview[0].Action != "delete" || preview[0].Path != backup {
+                t.Errorf("got preview %+v, want the backup deleted", preview)
+        }
+        if _, err := os.Lstat(backup); err != nil {
+                t.Errorf("dry run removed the backup: %v", err)
+        }
+
+        if _, err := CommitOrganize(dir, models.UndoOptions{}); err != nil {
+                t.Fatal(err)
+        }
+        if _, err := os.Lstat(backup); !os.IsNotExist(err) {
+                t.Error("backup still exists after commit")
+        }
+        if got := readFile(t, replaced); got != "new notes" {
+                t.Errorf("target holds %q after commit", got)
+        }
+
+        entries, err := ReadJournal(filepath.Join(dir, JournalName))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(entries) != 1 || entries[0].Op != DedupeDelete {
+                t.Errorf("got journal %+v, want only the dedupe entry", entries)
+        }
+        if _, err := UndoOrganize(dir, models.UndoOptions{}); err == nil {
+                t.Error("committed run can still be undone")
+        }
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+        t.Helper()
+        info, err := os.Lstat(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return info
+}
@@ -0,0 +1,117 @@
+package fileops
+
+import (
+        "bufio"
+        "bytes"
+        "fmt"
+        "os"
+        "regexp"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+const (
+        // binarySniffLen is how much of a file is inspected for NUL bytes
+        binarySniffLen = 8000
+        // maxLineLength bounds the memory used for a single line
+        maxLineLength = 1024 * 1024
+)
+
+// lineMatcher reports whether a line satisfies a content query
+type lineMatcher func(line string) bool
+
+// compileContentMatcher builds the line matcher for a content search,
+// returning nil when no content pattern was requested
+func compileContentMatcher(opts models.SearchOptions) (lineMatcher, error) {
+        if opts.ContentPattern == "" {
+                return nil, nil
+        }
+
+        if opts.ContentRegex {
+                expr := opts.ContentPattern
+                if opts.ContentIgnoreCase {
+                        expr = "(?i)" + expr
+                }
+                re, err := regexp.Compile(expr)
+                if err != nil {
+                        return nil, fmt.Errorf("invalid content pattern: %w", err)
+                }
+                return re.MatchString, nil
+        }
+
+        if opts.ContentIgnoreCase {
+                needle := strings.ToLower(opts.ContentPattern)
+                return func(line string) bool {
+                        return strings.Contains(strings.ToLower(line), needle)
+                }, nil
+        }
+
+        needle := opts.ContentPattern
+        return func(line string) bool {
+                return strings.Contains(line, needle)
+        }, nil
+}
+
+// searchContent scans a file line by line and returns every matching line
+// together with up to contextLines lines of surrounding context.
+// Binary files (those containing a NUL byte near the start) yield no matches.
+func searchContent(path string, match lineMatcher, contextLines int) ([]models.ContentMatch, error) {
+        f, err := os.Open(path)
+        if err != nil {
+                return nil, err
+        }
+        defer f.Close()
+
+        reader := bufio.NewReader(f)
+        head, _ := reader.Peek(binarySniffLen)
+        if bytes.IndexByte(head, 0) >= 0 {
+                return nil, nil
+        }
+
+        scanner := bufio.NewScanner(reader)
+        scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+        var matches []models.ContentMatch
+        var before []string
+        var pending []int
+        lineNum := 0
+
+        for scanner.Scan() {
+                lineNum++
+                line := scanner.Text()
+
+                // Feed trailing context to earlier matches
+                open := pending[:0]
+                for _, idx := range pending {
+                        matches[idx].After = append(matches[idx].After, line)
+                        if len(matches[idx].After) < contextLines {
+                                open = append(open, idx)
+                        }
+                }
+                pending = open
+
+                if match(line) {
+                        m := models.ContentMatch{Line: lineNum, Text: line}
+                        if contextLines > 0 {
+                                m.Before = append([]string(nil), before...)
+                                pending = append(pending, len(matches))
+                        }
+                        matches = append(matches, m)
+                }
+
+                if contextLines > 0 {
+                        before = append(before, line)
+                        if len(before) > contextLines {
+                                before = before[1:]
+                        }
+                }
+        }
+
+        // Overlong lines end the scan but keep what was found so far
+        if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+                return matches, err
+        }
+
+        return matches, nil
+}
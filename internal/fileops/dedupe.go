@@ -0,0 +1,197 @@
+package fileops
+
+import (
+        "errors"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+        "syscall"
+
+        "github.com/user/filer/internal/models"
+)
+
+// Dedupe actions
+const (
+        DedupeLink   = "link"
+        DedupeDelete = "delete"
+)
+
+// Keeper selection strategies
+const (
+        KeepOldest   = "oldest"
+        KeepNewest   = "newest"
+        KeepShortest = "shortest"
+        KeepPriority = "priority"
+)
+
+// ResolveDuplicates keeps one file from each duplicate set and either
+// replaces the others with hard links to it or deletes them. The keeper
+// and each duplicate are re-hashed immediately before they are acted on:
+// duplicates that changed since the scan are skipped, and a set whose
+// keeper changed is skipped entirely, so the original contents are never
+// lost. Hard links are only created within a filesystem; duplicates on
+// another device are skipped. With DryRun set the planned actions are
+// returned without changing anything.
+func ResolveDuplicates(sets []*models.DuplicateSet, opts models.DedupeOptions) ([]*models.DedupeResult, error) {
+        if opts.Action != DedupeLink && opts.Action != DedupeDelete {
+                return nil, fmt.Errorf("unknown dedupe action %q (expected link or delete)", opts.Action)
+        }
+
+        var journal *Journal
+        if !opts.DryRun && opts.JournalPath != "" {
+                var err error
+                journal, err = OpenJournal(opts.JournalPath)
+                if err != nil {
+                        return nil, err
+                }
+                defer journal.Close()
+        }
+
+        var results []*models.DedupeResult
+
+        for _, set := range sets {
+                keeper, err := ChooseKeeper(set, opts.Keep, opts.Priority)
+                if err != nil {
+                        return results, err
+                }
+
+                // The keeper must still hold the contents the set was found with
+                keeperChanged := false
+                if !opts.DryRun {
+                        hash, err := HashFile(keeper.Path, 0)
+                        keeperChanged = err != nil || hash != set.Hash
+                }
+
+                for _, file := range set.Files {
+                        if file == keeper {
+                                continue
+                        }
+
+                        result := &models.DedupeResult{
+                                Action: opts.Action,
+                                Path:   file.Path,
+                                Keeper: keeper.Path,
+                                Size:   file.Size,
+                        }
+                        results = append(results, result)
+
+                        if opts.DryRun {
+                                continue
+                        }
+
+                        if keeperChanged {
+                                result.Action = "skip"
+                                result.Reason = "keeper changed since scan"
+                                continue
+                        }
+
+                        // Never act on a file whose contents changed since the scan
+                        if hash, err := HashFile(file.Path, 0); err != nil || hash != set.Hash {
+                                result.Action = "skip"
+                                result.Reason = "changed since scan"
+                                continue
+                        }
+
+                        if opts.Action == DedupeLink {
+                                err = replaceWithLink(keeper.Path, file.Path)
+                                if errors.Is(err, syscall.EXDEV) {
+                                        result.Action = "skip"
+                                        result.Reason = "on a different filesystem"
+                                        continue
+                                }
+                        } else {
+                                err = os.Remove(file.Path)
+                        }
+                        if err != nil {
+                                return results, err
+                        }
+
+                        if journal != nil {
+                                if err := journal.Record(models.JournalEntry{
+                                        Op:     opts.Action,
+                                        Path:   file.Path,
+                                        Target: keeper.Path,
+                                        Size:   file.Size,
+                                        Hash:   set.Hash,
+                                }); err != nil {
+                                        return results, err
+                                }
+                        }
+                }
+        }
+
+        return results, nil
+}
+
+// ChooseKeeper picks the file to keep from a duplicate set. The priority
+// strategy keeps the file under the earliest listed directory, falling
+// back to the oldest file when none match.
+func ChooseKeeper(set *models.DuplicateSet, keep string, priority []string) (*models.FileInfo, error) {
+        var better func(a, b *models.FileInfo) bool
+
+        switch keep {
+        case "", KeepOldest:
+                better = func(a, b *models.FileInfo) bool { return a.ModTime.Before(b.ModTime) }
+        case KeepNewest:
+                better = func(a, b *models.FileInfo) bool { return a.ModTime.After(b.ModTime) }
+        case KeepShortest:
+                better = func(a, b *models.FileInfo) bool { return len(a.Path) < len(b.Path) }
+        case KeepPriority:
+                if len(priority) == 0 {
+                        return nil, fmt.Errorf("the priority keep strategy requires a list of directories")
+                }
+                better = func(a, b *models.FileInfo) bool {
+                        ra, rb := priorityRank(a.Path, priority), priorityRank(b.Path, priority)
+                        if ra != rb {
+                                return ra < rb
+                        }
+                        return a.ModTime.Before(b.ModTime)
+                }
+        default:
+                return nil, fmt.Errorf("unknown keep strategy %q (expected oldest, newest, shortest or priority)", keep)
+        }
+
+        keeper := set.Files[0]
+        for _, file := range set.Files[1:] {
+                if better(file, keeper) {
+                        keeper = file
+                }
+        }
+        return keeper, nil
+}
+
+// priorityRank returns the index of the first priority directory that
+// contains path, or len(priority) when none does
+func priorityRank(path string, priority []string) int {
+        abs, err := filepath.Abs(path)
+        if err != nil {
+                abs = path
+        }
+
+        for i, dir := range priority {
+                dirAbs, err := filepath.Abs(dir)
+                if err != nil {
+                        dirAbs = dir
+                }
+                if abs == dirAbs || strings.HasPrefix(abs, dirAbs+string(filepath.Separator)) {
+                        return i
+                }
+        }
+        return len(priority)
+}
+
+// replaceWithLink atomically replaces dup with a hard link to keeper by
+// linking to a temporary name beside dup and renaming it into place
+func replaceWithLink(keeper, dup string) error {
+        tmp := filepath.Join(filepath.Dir(dup), fmt.Sprintf(".filer-link-%d-%s", os.Getpid(), filepath.Base(dup)))
+        if err := os.Link(keeper, tmp); err != nil {
+                return err
+        }
+
+        if err := os.Rename(tmp, dup); err != nil {
+                os.Remove(tmp)
+                return err
+        }
+        return nil
+}
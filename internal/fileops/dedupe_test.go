@@ -0,0 +1,175 @@
+package fileops
+
+import (
+        "os"
+        "path/filepath"
+        "testing"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// writeFile creates a file (and its parent directories) with the given
+// contents and modification time
+func writeFile(t *testing.T, path, contents string, modTime time.Time) {
+        t.Helper()
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+                t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+                t.Fatal(err)
+        }
+        if err := os.Chtimes(path, modTime, modTime); err != nil {
+                t.Fatal(err)
+        }
+}
+
+// readFile returns a file's contents, failing the test if it is missing
+func readFile(t *testing.T, path string) string {
+        t.Helper()
+        data, err := os.ReadFile(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return string(data)
+}
+
+// findSets scans dir for duplicates, expecting exactly want sets
+func findSets(t *testing.T, dir string, want int) []*models.DuplicateSet {
+        t.Helper()
+        sets, err := FindDuplicates([]string{dir}, models.SearchOptions{})
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(sets) != want {
+                t.Fatalf("found %d duplicate sets, want %d", len(sets), want)
+        }
+        return sets
+}
+
+func TestFindDuplicatesIgnoresHardLinks(t *testing.T) {
+        dir := t.TempDir()
+        now := time.Now()
+        writeFile(t, filepath.Join(dir, "a.txt"), "same", now)
+        if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")); err != nil {
+                t.Fatal(err)
+        }
+        findSets(t, dir, 0)
+
+        // A real copy is a duplicate of the linked file only once
+        writeFile(t, filepath.Join(dir, "c.txt"), "same", now)
+        sets := findSets(t, dir, 1)
+        if len(sets[0].Files) != 2 {
+                t.Errorf("set has %d files, want 2", len(sets[0].Files))
+        }
+}
+
+func TestResolveDuplicates(t *testing.T) {
+        tests := []struct {
+                action string
+                linked bool
+        }{
+                {DedupeDelete, false},
+                {DedupeLink, true},
+        }
+
+        for _, tt := range tests {
+                dir := t.TempDir()
+                old := time.Now().Add(-time.Hour)
+                keeper, dup := filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")
+                writeFile(t, keeper, "same", old)
+                writeFile(t, dup, "same", time.Now())
+
+                journalPath := filepath.Join(dir, JournalName)
+                results, err := ResolveDuplicates(findSets(t, dir, 1), models.DedupeOptions{Action: tt.action, JournalPath: journalPath})
+                if err != nil {
+                        t.Fatalf("%s: %v", tt.action, err)
+                }
+                if len(results) != 1 || results[0].Action != tt.action || results[0].Path != dup || results[0].Keeper != keeper {
+                        t.Errorf("%s: got results %+v", tt.action, results)
+                }
+
+                info, err := os.Stat(dup)
+                switch {
+                case tt.linked && err != nil:
+                        t.Errorf("%s: duplicate is gone: %v", tt.action, err)
+                case tt.linked:
+                        keeperInfo, _ := os.Stat(keeper)
+                        if !os.SameFile(info, keeperInfo) {
+                                t.Errorf("%s: duplicate is not a hard link to the keeper", tt.action)
+                        }
+                case !os.IsNotExist(err):
+                        t.Errorf("%s: duplicate still exists", tt.action)
+                }
+                if got := readFile(t, keeper); got != "same" {
+                        t.Errorf("%s: keeper holds %q", tt.action, got)
+                }
+
+                entries, err := ReadJournal(journalPath)
+                if err != nil {
+                        t.Fatalf("%s: %v", tt.action, err)
+                }
+                if len(entries) != 1 || entries[0].Op != tt.action || entries[0].Path != dup || entries[0].Target != keeper {
+                        t.Errorf("%s: got journal %+v", tt.action, entries)
+                }
+        }
+}
+
+func TestResolveDuplicatesSkipsChangedFiles(t *testing.T) {
+        tests := []struct {
+                name    string
+                changed string // which file changes after the scan
+                reason  string
+        }{
+                {"keeper changed", "a.txt", "keeper changed since scan"},
+                {"duplicate changed", "b.txt", "changed since scan"},
+        }
+
+        for _, tt := range tests {
+                for _, action := range []string{DedupeDelete, DedupeLink} {
+                        dir := t.TempDir()
+                        old := time.Now().Add(-time.Hour)
+                        writeFile(t, filepath.Join(dir, "a.txt"), "same", old)
+                        writeFile(t, filepath.Join(dir, "b.txt"), "same", time.Now())
+
+                        sets := findSets(t, dir, 1)
+                        writeFile(t, filepath.Join(dir, tt.changed), "different", time.Now())
+
+                        results, err := ResolveDuplicates(sets, models.DedupeOptions{Action: action})
+                        if err != nil {
+                                t.Fatalf("%s, %s: %v", tt.name, action, err)
+                        }
+                        if len(results) != 1 || results[0].Action != "skip" || results[0].Reason != tt.reason {
+                                t.Errorf("%s, %s: got results %+v", tt.name, action, results)
+                        }
+
+                        // Both files keep their own contents
+                        for _, name := range []string{"a.txt", "b.txt"} {
+                                want := "same"
+                                if name == tt.changed {
+                                        want = "different"
+                                }
+                                if got := readFile(t, filepath.Join(dir, name)); got != want {
+                                        t.Errorf("%s, %s: %s holds %q, want %q", tt.name, action, name, got, want)
+                                }
+                        }
+                }
+        }
+}
+
+func TestResolveDuplicatesDryRun(t *testing.T) {
+        dir := t.TempDir()
+        writeFile(t, filepath.Join(dir, "a.txt"), "same", time.Now().Add(-time.Hour))
+        writeFile(t, filepath.Join(dir, "b.txt"), "same", time.Now())
+
+        results, err := ResolveDuplicates(findSets(t, dir, 1), models.DedupeOptions{Action: DedupeDelete, DryRun: true})
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(results) != 1 || results[0].Action != DedupeDelete {
+                t.Errorf("got results %+v", results)
+        }
+        if got := readFile(t, filepath.Join(dir, "b.txt")); got != "same" {
+                t.Errorf("dry run changed b.txt to %q", got)
+        }
+}
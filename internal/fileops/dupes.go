@@ -0,0 +1,179 @@
+package fileops
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "io"
+        "io/fs"
+        "os"
+        "path/filepath"
+        "sort"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+// partialHashSize is how much of each file is hashed before committing to
+// a full hash
+const partialHashSize = 64 * 1024
+
+// dupeCandidate pairs a file with the stat used to detect hard links
+type dupeCandidate struct {
+        file *models.FileInfo
+        info os.FileInfo
+}
+
+// hashGroup is a set of candidates sharing a hash
+type hashGroup struct {
+        hash    string
+        members []dupeCandidate
+}
+
+// FindDuplicates finds files with identical contents under the given
+// directories. Files are grouped by size, then by a hash of their first
+// bytes, and finally by a full SHA-256 hash, so most files are never read
+// in full. Empty files and additional hard links to the same file are
+// ignored. Sets are returned with the most wasted space first.
+func FindDuplicates(dirs []string, opts models.SearchOptions) ([]*models.DuplicateSet, error) {
+        bySize := make(map[int64][]dupeCandidate)
+
+        for _, dir := range dirs {
+                err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+                        if err != nil {
+                                return err
+                        }
+
+                        // Skip hidden files if not requested
+                        if !opts.IncludeHidden && strings.HasPrefix(d.Name(), ".") && path != dir {
+                                if d.IsDir() {
+                                        return filepath.SkipDir
+                                }
+                                return nil
+                        }
+
+                        if !d.Type().IsRegular() {
+                                return nil
+                        }
+
+                        info, err := d.Info()
+                        if err != nil {
+                                return err
+                        }
+
+                        fileInfo := models.NewFileInfo(path, info)
+                        if fileInfo.Size == 0 || !MatchesFilters(fileInfo, opts) {
+                                return nil
+                        }
+
+                        // Hard links (or overlapping directories) are the same file
+                        for _, existing := range bySize[fileInfo.Size] {
+                                if os.SameFile(existing.info, info) {
+                                        return nil
+                                }
+                        }
+
+                        bySize[fileInfo.Size] = append(bySize[fileInfo.Size], dupeCandidate{fileInfo, info})
+                        return nil
+                })
+                if err != nil {
+                        return nil, err
+                }
+        }
+
+        var sets []*models.DuplicateSet
+
+        for size, group := range bySize {
+                if len(group) < 2 {
+                        continue
+                }
+
+                for _, partial := range groupByHash(group, partialHashSize) {
+                        // Small files were hashed in full by the first pass
+                        full := []hashGroup{partial}
+                        if size > partialHashSize {
+                                full = groupByHash(partial.members, 0)
+                        }
+
+                        for _, same := range full {
+                                sets = append(sets, newDuplicateSet(same))
+                        }
+                }
+        }
+
+        sort.Slice(sets, func(i, j int) bool {
+                if sets[i].WastedBytes != sets[j].WastedBytes {
+                        return sets[i].WastedBytes > sets[j].WastedBytes
+                }
+                return sets[i].Files[0].Path < sets[j].Files[0].Path
+        })
+
+        return sets, nil
+}
+
+// groupByHash splits candidates by the hash of their first limit bytes
+// (the whole file when limit is 0), keeping only groups with duplicates.
+// Unreadable files are dropped.
+func groupByHash(group []dupeCandidate, limit int64) []hashGroup {
+        byHash := make(map[string][]dupeCandidate)
+        var order []string
+
+        for _, c := range group {
+                hash, err := HashFile(c.file.Path, limit)
+                if err != nil {
+                        continue
+                }
+                if _, seen := byHash[hash]; !seen {
+                        order = append(order, hash)
+                }
+                byHash[hash] = append(byHash[hash], c)
+        }
+
+        var groups []hashGroup
+        for _, hash := range order {
+                if len(byHash[hash]) > 1 {
+                        groups = append(groups, hashGroup{hash, byHash[hash]})
+                }
+        }
+        return groups
+}
+
+func newDuplicateSet(group hashGroup) *models.DuplicateSet {
+        files := make([]*models.FileInfo, len(group.members))
+        for i, c := range group.members {
+                files[i] = c.file
+        }
+        sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+        size := files[0].Size
+        wasted := size * int64(len(files)-1)
+
+        return &models.DuplicateSet{
+                Hash:        group.hash,
+                Size:        size,
+                SizeHuman:   formatBytes(size),
+                Files:       files,
+                WastedBytes: wasted,
+                WastedHuman: formatBytes(wasted),
+        }
+}
+
+// HashFile returns the hex SHA-256 of the first limit bytes of a file,
+// or of the whole file when limit is 0
+func HashFile(path string, limit int64) (string, error) {
+        f, err := os.Open(path)
+        if err != nil {
+                return "", err
+        }
+        defer f.Close()
+
+        var r io.Reader = f
+        if limit > 0 {
+                r = io.LimitReader(f, limit)
+        }
+
+        h := sha256.New()
+        if _, err := io.Copy(h, r); err != nil {
+                return "", err
+        }
+        return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,130 @@
+package fileops
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/binary"
+        "io"
+        "os"
+        "strings"
+        "time"
+)
+
+// EXIF tags read by exifDateTaken
+const (
+        exifIFDPointerTag   = 0x8769
+        dateTimeOriginalTag = 0x9003
+)
+
+// exifDateTaken returns the DateTimeOriginal recorded in a JPEG's EXIF
+// metadata. It reports false for non-JPEG files and files without the tag.
+func exifDateTaken(path string) (time.Time, bool) {
+        f, err := os.Open(path)
+        if err != nil {
+                return time.Time{}, false
+        }
+        defer f.Close()
+
+        tiff := readExifSegment(bufio.NewReader(f))
+        if tiff == nil {
+                return time.Time{}, false
+        }
+
+        value, ok := readDateTimeOriginal(tiff)
+        if !ok {
+                return time.Time{}, false
+        }
+
+        taken, err := time.ParseInLocation("2006:01:02 15:04:05", value, time.Local)
+        if err != nil {
+                return time.Time{}, false
+        }
+        return taken, true
+}
+
+// readExifSegment walks the JPEG markers up to the image data and returns
+// the TIFF structure inside the APP1 Exif segment, or nil
+func readExifSegment(r *bufio.Reader) []byte {
+        var soi [2]byte
+        if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+                return nil
+        }
+
+        for {
+                var header [4]byte
+                if _, err := io.ReadFull(r, header[:]); err != nil || header[0] != 0xFF {
+                        return nil
+                }
+
+                marker := header[1]
+                length := int(binary.BigEndian.Uint16(header[2:])) - 2
+                if marker == 0xDA || marker == 0xD9 || length < 0 {
+                        // Start of scan or end of image: no metadata follows
+                        return nil
+                }
+
+                segment := make([]byte, length)
+                if _, err := io.ReadFull(r, segment); err != nil {
+                        return nil
+                }
+
+                if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+                        return segment[6:]
+                }
+        }
+}
+
+// readDateTimeOriginal finds the DateTimeOriginal tag in the EXIF sub-IFD
+func readDateTimeOriginal(tiff []byte) (string, bool) {
+        if len(tiff) < 8 {
+                return "", false
+        }
+
+        var order binary.ByteOrder
+        switch string(tiff[:2]) {
+        case "II":
+                order = binary.LittleEndian
+        case "MM":
+                order = binary.BigEndian
+        default:
+                return "", false
+        }
+
+        ifd0 := order.Uint32(tiff[4:8])
+        exifIFD, ok := findIFDEntry(tiff, order, ifd0, exifIFDPointerTag)
+        if !ok {
+                return "", false
+        }
+
+        offset, ok := findIFDEntry(tiff, order, order.Uint32(exifIFD[8:12]), dateTimeOriginalTag)
+        if !ok {
+                return "", false
+        }
+
+        // The 20-byte ASCII value never fits inline, so it is stored at an offset
+        start := int(order.Uint32(offset[8:12]))
+        if start < 0 || start+19 > len(tiff) {
+                return "", false
+        }
+        return strings.TrimRight(string(tiff[start:start+19]), "\x00 "), true
+}
+
+// findIFDEntry returns the 12-byte entry for tag in the IFD at offset
+func findIFDEntry(tiff []byte, order binary.ByteOrder, offset uint32, tag uint16) ([]byte, bool) {
+        start := int(offset)
+        if start < 0 || start+2 > len(tiff) {
+                return nil, false
+        }
+
+        count := int(order.Uint16(tiff[start:]))
+        for i := 0; i < count; i++ {
+                entry := start + 2 + i*12
+                if entry+12 > len(tiff) {
+                        return nil, false
+                }
+                if order.Uint16(tiff[entry:]) == tag {
+                        return tiff[entry : entry+12], true
+                }
+        }
+        return nil, false
+}
@@ -0,0 +1,193 @@
+package fileops
+
+import (
+        "bufio"
+        "encoding/json"
+        "os"
+        "path/filepath"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// JournalName is the file, inside the affected directory, where filer
+// records the changes it makes
+const JournalName = ".filer-journal.jsonl"
+
+// Journal operations recorded by organize
+const (
+        OpMove      = "move"
+        OpMkdir     = "mkdir"
+        OpOverwrite = "overwrite"
+)
+
+// Journal appends entries to a newline-delimited JSON journal file. Each
+// entry is written as soon as it is recorded, so the journal stays accurate
+// even if a run is interrupted. Paths are stored relative to the journal's
+// directory so the journal remains valid wherever filer is run from.
+type Journal struct {
+        f    *os.File
+        enc  *json.Encoder
+        base string
+        run  string
+}
+
+// OpenJournal opens (creating if necessary) a journal for appending.
+// All entries recorded through the returned journal share one run ID.
+func OpenJournal(path string) (*Journal, error) {
+        base, err := filepath.Abs(filepath.Dir(path))
+        if err != nil {
+                return nil, err
+        }
+
+        f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+        if err != nil {
+                return nil, err
+        }
+
+        return &Journal{
+                f:    f,
+                enc:  json.NewEncoder(f),
+                base: base,
+                run:  NewRunID(),
+        }, nil
+}
+
+// NewRunID returns a run ID for a new journal run
+func NewRunID() string {
+        return time.Now().UTC().Format("20060102T150405.000000000Z")
+}
+
+// Record appends an entry, stamping it with the run ID and current time
+func (j *Journal) Record(entry models.JournalEntry) error {
+        entry.Run = j.run
+        entry.Time = time.Now()
+        entry.Path = j.relative(entry.Path)
+        if entry.Target != "" {
+                entry.Target = j.relative(entry.Target)
+        }
+        return j.enc.Encode(entry)
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+        return j.f.Close()
+}
+
+func (j *Journal) relative(path string) string {
+        abs, err := filepath.Abs(path)
+        if err != nil {
+                return path
+        }
+        rel, err := filepath.Rel(j.base, abs)
+        if err != nil {
+                return abs
+        }
+        return rel
+}
+
+// ReadJournal reads every entry of a journal, resolving paths relative to
+// the journal's directory
+func ReadJournal(path string) ([]models.JournalEntry, error) {
+        f, err := os.Open(path)
+        if err != nil {
+                return nil, err
+        }
+        defer f.Close()
+
+        base := filepath.Dir(path)
+        var entries []models.JournalEntry
+
+        scanner := bufio.NewScanner(f)
+        scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+        for scanner.Scan() {
+                if len(scanner.Bytes()) == 0 {
+                        continue
+                }
+
+                var entry models.JournalEntry
+                if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+                        return nil, err
+                }
+                entry.Path = resolveJournalPath(base, entry.Path)
+                entry.Target = resolveJournalPath(base, entry.Target)
+                entries = append(entries, entry)
+        }
+
+        return entries, scanner.Err()
+}
+
+// WriteJournal replaces a journal with the given entries (as returned by
+// ReadJournal), removing the file entirely when no entries remain
+func WriteJournal(path string, entries []models.JournalEntry) error {
+        if len(entries) == 0 {
+                err := os.Remove(path)
+                if os.IsNotExist(err) {
+                        return nil
+                }
+                return err
+        }
+
+        base, err := filepath.Abs(filepath.Dir(path))
+        if err != nil {
+                return err
+        }
+
+        tmp := path + ".tmp"
+        f, err := os.Create(tmp)
+        if err != nil {
+                return err
+        }
+
+        j := &Journal{f: f, enc: json.NewEncoder(f), base: base}
+        for _, entry := range entries {
+                entry.Path = j.relative(entry.Path)
+                if entry.Target != "" {
+                        entry.Target = j.relative(entry.Target)
+                }
+                if err := j.enc.Encode(entry); err != nil {
+                        f.Close()
+                        os.Remove(tmp)
+                        return err
+                }
+        }
+
+        if err := f.Close(); err != nil {
+                os.Remove(tmp)
+                return err
+        }
+        return os.Rename(tmp, path)
+}
+
+// mkdirAllJournaled creates dir and any missing parents, recording each
+// directory it creates so undo can remove them again
+func mkdirAllJournaled(dir string, journal *Journal) error {
+        var missing []string
+        for path := filepath.Clean(dir); ; path = filepath.Dir(path) {
+                if _, err := os.Stat(path); err == nil {
+                        break
+                }
+                missing = append(missing, path)
+                if filepath.Dir(path) == path {
+                        break
+                }
+        }
+
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return err
+        }
+
+        for i := len(missing) - 1; i >= 0; i-- {
+                if err := journal.Record(models.JournalEntry{Op: OpMkdir, Path: missing[i]}); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
+
+func resolveJournalPath(base, path string) string {
+        if path == "" || filepath.IsAbs(path) {
+                return path
+        }
+        return filepath.Join(base, path)
+}
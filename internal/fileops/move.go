@@ -0,0 +1,129 @@
+package fileops
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "errors"
+        "fmt"
+        "io"
+        "os"
+        "path/filepath"
+        "syscall"
+        "time"
+)
+
+// MoveFile moves src to dst, replacing any existing dst. When the two are
+// on different devices (where os.Rename fails with EXDEV) the file is
+// copied to a temporary file beside dst, verified against the source's
+// SHA-256, given the source's mode, modification time and, where
+// permitted, ownership, and renamed into place before the source is
+// removed.
+func MoveFile(src, dst string) error {
+        err := os.Rename(src, dst)
+        if err == nil || !errors.Is(err, syscall.EXDEV) {
+                return err
+        }
+        return moveAcrossDevices(src, dst)
+}
+
+func moveAcrossDevices(src, dst string) error {
+        info, err := os.Lstat(src)
+        if err != nil {
+                return err
+        }
+
+        if info.Mode()&os.ModeSymlink != 0 {
+                link, err := os.Readlink(src)
+                if err != nil {
+                        return err
+                }
+
+                // Link beside dst and rename into place, replacing any dst
+                tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".filer-move-%d-%s", os.Getpid(), filepath.Base(dst)))
+                if err := os.Symlink(link, tmp); err != nil {
+                        return err
+                }
+                if err := os.Rename(tmp, dst); err != nil {
+                        os.Remove(tmp)
+                        return err
+                }
+                return os.Remove(src)
+        }
+
+        if !info.Mode().IsRegular() {
+                return fmt.Errorf("cannot move %s across devices: not a regular file", src)
+        }
+
+        tmpPath, err := copyToTemp(src, filepath.Dir(dst))
+        if err != nil {
+                return err
+        }
+
+        if err := finishCopy(tmpPath, src, info); err != nil {
+                os.Remove(tmpPath)
+                return err
+        }
+
+        if err := os.Rename(tmpPath, dst); err != nil {
+                os.Remove(tmpPath)
+                return err
+        }
+
+        return os.Remove(src)
+}
+
+// copyToTemp copies src into a new temporary file in dir, verifying the
+// copy on disk against the bytes read from the source
+func copyToTemp(src, dir string) (string, error) {
+        in, err := os.Open(src)
+        if err != nil {
+                return "", err
+        }
+        defer in.Close()
+
+        tmp, err := os.CreateTemp(dir, ".filer-move-*")
+        if err != nil {
+                return "", err
+        }
+
+        h := sha256.New()
+        _, err = io.Copy(io.MultiWriter(tmp, h), in)
+        if err == nil {
+                err = tmp.Sync()
+        }
+        if closeErr := tmp.Close(); err == nil {
+                err = closeErr
+        }
+        if err != nil {
+                os.Remove(tmp.Name())
+                return "", err
+        }
+
+        copied, err := HashFile(tmp.Name(), 0)
+        if err != nil || copied != hex.EncodeToString(h.Sum(nil)) {
+                os.Remove(tmp.Name())
+                return "", fmt.Errorf("verification of copy of %s failed", src)
+        }
+
+        return tmp.Name(), nil
+}
+
+// finishCopy applies the source's metadata to the copy and makes sure the
+// source did not change while it was being copied
+func finishCopy(tmpPath, src string, info os.FileInfo) error {
+        after, err := os.Lstat(src)
+        if err != nil {
+                return err
+        }
+        if after.Size() != info.Size() || !after.ModTime().Equal(info.ModTime()) {
+                return fmt.Errorf("%s changed while it was being moved", src)
+        }
+
+        if err := copyOwnership(tmpPath, info); err != nil {
+                return err
+        }
+        if err := os.Chmod(tmpPath, info.Mode()); err != nil {
+                return err
+        }
+        return os.Chtimes(tmpPath, time.Now(), info.ModTime())
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fileops
+
+import "os"
+
+// copyOwnership is a no-op on platforms without Unix ownership
+func copyOwnership(path string, info os.FileInfo) error {
+        return nil
+}
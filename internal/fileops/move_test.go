@@ -0,0 +1,144 @@
+package fileops
+
+import (
+        "os"
+        "path/filepath"
+        "testing"
+        "time"
+)
+
+func TestMoveFileReplacesTarget(t *testing.T) {
+        dir := t.TempDir()
+        src, dst := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+        writeFile(t, src, "source", time.Now())
+        writeFile(t, dst, "existing", time.Now())
+
+        if err := MoveFile(src, dst); err != nil {
+                t.Fatal(err)
+        }
+        if got := readFile(t, dst); got != "source" {
+                t.Errorf("target holds %q", got)
+        }
+        if _, err := os.Lstat(src); !os.IsNotExist(err) {
+                t.Error("source still exists")
+        }
+}
+
+// The tests below call moveAcrossDevices directly, since os.Rename only
+// fails with EXDEV between real filesystems
+
+func TestMoveAcrossDevices(t *testing.T) {
+        for _, existing := range []bool{false, true} {
+                dir := t.TempDir()
+                src, dst := filepath.Join(dir, "in", "a.txt"), filepath.Join(dir, "out", "a.txt")
+                modTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+                writeFile(t, src, "source", modTime)
+                if err := os.Chmod(src, 0600); err != nil {
+                        t.Fatal(err)
+                }
+                if existing {
+                        writeFile(t, dst, "existing", time.Now())
+                } else if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+                        t.Fatal(err)
+                }
+
+                if err := moveAcrossDevices(src, dst); err != nil {
+                        t.Fatalf("existing=%v: %v", existing, err)
+                }
+
+                if got := readFile(t, dst); got != "source" {
+                        t.Errorf("existing=%v: target holds %q", existing, got)
+                }
+                info := mustStat(t, dst)
+                if info.Mode().Perm() != 0600 {
+                        t.Errorf("existing=%v: got mode %v, want -rw-------", existing, info.Mode())
+                }
+                if !info.ModTime().Equal(modTime) {
+                        t.Errorf("existing=%v: got modification time %v, want %v", existing, info.ModTime(), modTime)
+                }
+                if _, err := os.Lstat(src); !os.IsNotExist(err) {
+                        t.Errorf("existing=%v: source still exists", existing)
+                }
+                assertNoTempFiles(t, filepath.Dir(dst))
+        }
+}
+
+func TestMoveAcrossDevicesSymlink(t *testing.T) {
+        for _, existing := range []bool{false, true} {
+                dir := t.TempDir()
+                src, dst := filepath.Join(dir, "in", "link"), filepath.Join(dir, "out", "link")
+                if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+                        t.Fatal(err)
+                }
+                if err := os.Symlink("../target.txt", src); err != nil {
+                        t.Fatal(err)
+                }
+                if existing {
+                        writeFile(t, dst, "existing", time.Now())
+                } else if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+                        t.Fatal(err)
+                }
+
+                if err := moveAcrossDevices(src, dst); err != nil {
+                        t.Fatalf("existing=%v: %v", existing, err)
+                }
+
+                // The link itself moves, pointing where it did before
+                link, err := os.Readlink(dst)
+                if err != nil || link != "../target.txt" {
+                        t.Errorf("existing=%v: target links to %q (%v), want ../target.txt", existing, link, err)
+                }
+                if _, err := os.Lstat(src); !os.IsNotExist(err) {
+                        t.Errorf("existing=%v: source still exists", existing)
+                }
+                assertNoTempFiles(t, filepath.Dir(dst))
+        }
+}
+
+func TestMoveAcrossDevicesRejectsSpecialFiles(t *testing.T) {
+        dir := t.TempDir()
+        src := filepath.Join(dir, "sub")
+        if err := os.Mkdir(src, 0755); err != nil {
+                t.Fatal(err)
+        }
+
+        if err := moveAcrossDevices(src, filepath.Join(dir, "moved")); err == nil {
+                t.Error("expected an error moving a directory")
+        }
+        if _, err := os.Stat(src); err != nil {
+                t.Errorf("directory was removed: %v", err)
+        }
+}
+
+func TestFinishCopyDetectsChangedSource(t *testing.T) {
+        dir := t.TempDir()
+        src := filepath.Join(dir, "a.txt")
+        writeFile(t, src, "source", time.Now().Add(-time.Hour))
+        info := mustStat(t, src)
+
+        tmpPath, err := copyToTemp(src, dir)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if got := readFile(t, tmpPath); got != "source" {
+                t.Errorf("copy holds %q", got)
+        }
+
+        // The source is written to while it is being copied
+        writeFile(t, src, "source, edited", time.Now())
+        if err := finishCopy(tmpPath, src, info); err == nil {
+                t.Error("expected an error for a source that changed during the copy")
+        }
+}
+
+// assertNoTempFiles fails the test if a move left temporary files in dir
+func assertNoTempFiles(t *testing.T, dir string) {
+        t.Helper()
+        matches, err := filepath.Glob(filepath.Join(dir, ".filer-move-*"))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(matches) > 0 {
+                t.Errorf("temporary files left behind: %v", matches)
+        }
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package fileops
+
+import (
+        "errors"
+        "os"
+        "syscall"
+)
+
+// copyOwnership gives path the owner and group of info, ignoring
+// permission errors when the caller may not change ownership
+func copyOwnership(path string, info os.FileInfo) error {
+        st, ok := info.Sys().(*syscall.Stat_t)
+        if !ok {
+                return nil
+        }
+
+        err := os.Lchown(path, int(st.Uid), int(st.Gid))
+        if errors.Is(err, syscall.EPERM) {
+                return nil
+        }
+        return err
+}
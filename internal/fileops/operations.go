@@ -1,20 +1,39 @@
 package fileops
 
 import (
+        "errors"
         "fmt"
         "io/fs"
         "os"
         "path/filepath"
         "sort"
         "strings"
+        "time"
 
+        "github.com/user/filer/internal/mimetype"
         "github.com/user/filer/internal/models"
 )
 
+// StopWalk may be returned by a FileFunc to end a traversal early; the
+// traversal then returns nil
+var StopWalk = errors.New("stop walk")
+
+// FileFunc receives each file found by a streaming traversal
+type FileFunc func(file *models.FileInfo) error
+
 // ListFiles lists files in a directory with optional filtering
 func ListFiles(dir string, recursive bool, showHidden bool) ([]*models.FileInfo, error) {
         var files []*models.FileInfo
-        
+        err := ListFilesFunc(dir, recursive, showHidden, func(file *models.FileInfo) error {
+                files = append(files, file)
+                return nil
+        })
+        return files, err
+}
+
+// ListFilesFunc is the streaming form of ListFiles: fn is called for each
+// file as it is found, in lexical order, so nothing is kept in memory
+func ListFilesFunc(dir string, recursive bool, showHidden bool, fn FileFunc) error {
         if recursive {
                 err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
                         if err != nil {
@@ -34,16 +53,15 @@ func ListFiles(dir string, recursive bool, showHidden bool) ([]*models.FileInfo,
                                 return err
                         }
                         
-                        files = append(files, models.NewFileInfo(path, info))
-                        return nil
+                        return fn(models.NewFileInfo(path, info))
                 })
-                return files, err
+                return stopped(err)
         }
         
         // Non-recursive listing
         entries, err := os.ReadDir(dir)
         if err != nil {
-                return nil, err
+                return err
         }
         
         for _, entry := range entries {
@@ -57,17 +75,38 @@ func ListFiles(dir string, recursive bool, showHidden bool) ([]*models.FileInfo,
                 }
                 
                 fullPath := filepath.Join(dir, entry.Name())
-                files = append(files, models.NewFileInfo(fullPath, info))
+                if err := fn(models.NewFileInfo(fullPath, info)); err != nil {
+                        return stopped(err)
+                }
         }
         
-        return files, nil
+        return nil
 }
 
 // SearchFiles searches for files matching criteria
 func SearchFiles(dir string, opts models.SearchOptions) ([]*models.FileInfo, error) {
         var matches []*models.FileInfo
+        err := SearchFilesFunc(dir, opts, func(file *models.FileInfo) error {
+                matches = append(matches, file)
+                return nil
+        })
+        return matches, err
+}
+
+// SearchFilesFunc is the streaming form of SearchFiles: fn is called for
+// each match as soon as it is found
+func SearchFilesFunc(dir string, opts models.SearchOptions, fn FileFunc) error {
+        matchName, err := compileNameMatcher(opts)
+        if err != nil {
+                return err
+        }
+        
+        matchContent, err := compileContentMatcher(opts)
+        if err != nil {
+                return err
+        }
         
-        err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
                 if err != nil {
                         return err
                 }
@@ -88,79 +127,207 @@ func SearchFiles(dir string, opts models.SearchOptions) ([]*models.FileInfo, err
                 fileInfo := models.NewFileInfo(path, info)
                 
                 // Apply filters
-                if !matchesPattern(fileInfo, opts) {
+                relPath, err := filepath.Rel(dir, path)
+                if err != nil {
+                        relPath = path
+                }
+                if !matchName(fileInfo, filepath.ToSlash(relPath)) || !MatchesFilters(fileInfo, opts) {
                         return nil
                 }
                 
-                matches = append(matches, fileInfo)
-                return nil
+                // Content matching is the most expensive filter, so it runs last
+                if matchContent != nil {
+                        if fileInfo.IsDir || !info.Mode().IsRegular() {
+                                return nil
+                        }
+                        
+                        lines, err := searchContent(path, matchContent, opts.ContextLines)
+                        if err != nil || len(lines) == 0 {
+                                return nil
+                        }
+                        
+                        fileInfo.Matches = lines
+                        fileInfo.MatchCount = len(lines)
+                }
+                
+                return fn(fileInfo)
         })
         
-        return matches, err
+        return stopped(err)
+}
+
+// stopped turns a StopWalk from a FileFunc into success
+func stopped(err error) error {
+        if errors.Is(err, StopWalk) {
+                return nil
+        }
+        return err
 }
 
-// OrganizeFiles organizes files into subdirectories by type
-func OrganizeFiles(dir string, dryRun bool) (map[string][]string, error) {
-        organized := make(map[string][]string)
+// OrganizeFiles organizes files into subdirectories using opts.Rules
+// (DefaultRules when none are given); files no rule matches go to "other".
+// With opts.Sniff files are classified by their detected content type
+// rather than trusting their extension.
+// Recursive runs either flatten files from subdirectories into the top-level
+// categories or organize each subdirectory in place.
+// Existing files at a destination are handled according to opts.Conflict,
+// and the outcome for every file is returned grouped by category.
+// Every move and created directory is recorded in the directory's journal
+// so the run can be reversed with UndoOrganize; files that are overwritten
+// are kept under a hidden name (entry.Backup) until CommitOrganize. Calls
+// given the same opts.Run are recorded as one run and undone together.
+func OrganizeFiles(dir string, opts models.OrganizeOptions) (map[string][]*models.OrganizeEntry, error) {
+        organized := make(map[string][]*models.OrganizeEntry)
+        var journal *Journal
         
-        files, err := ListFiles(dir, false, false)
+        ruleSet := opts.Rules
+        if len(ruleSet) == 0 {
+                ruleSet = DefaultRules()
+        }
+        rules, err := compileRules(ruleSet)
         if err != nil {
                 return nil, err
         }
         
-        // Define file type mappings
-        typeMap := map[string]string{
-                "jpg": "images", "jpeg": "images", "png": "images", "gif": "images", "bmp": "images",
-                "mp4": "videos", "avi": "videos", "mov": "videos", "mkv": "videos", "wmv": "videos",
-                "mp3": "audio", "wav": "audio", "flac": "audio", "aac": "audio", "ogg": "audio",
-                "pdf": "documents", "doc": "documents", "docx": "documents", "txt": "documents",
-                "xls": "documents", "xlsx": "documents", "ppt": "documents", "pptx": "documents",
-                "zip": "archives", "rar": "archives", "tar": "archives", "gz": "archives", "7z": "archives",
+        // A template (or the date layout) overrides every rule's destination
+        template := opts.Template
+        switch opts.Layout {
+        case "", LayoutType:
+        case LayoutDate:
+                if template == "" {
+                        template = DefaultDateTemplate
+                }
+        default:
+                return nil, fmt.Errorf("unknown layout %q (expected type or date)", opts.Layout)
         }
+        if template != "" {
+                if err := checkDestTemplate(template); err != nil {
+                        return nil, err
+                }
+        }
+        
+        files, err := collectOrganizeFiles(dir, opts, rules, template)
+        if err != nil {
+                return nil, err
+        }
+        
+        now := time.Now()
+        
+        // Destinations already taken by earlier files in this run
+        claimed := make(map[string]bool)
         
         for _, file := range files {
-                if file.IsDir {
+                // Only regular files are organized; this leaves directories
+                // and symlinks (such as a linked category directory) alone
+                if file.IsDir || !strings.HasPrefix(file.Mode, "-") {
                         continue
                 }
                 
-                ext := strings.ToLower(file.Extension)
-                category, exists := typeMap[ext]
-                if !exists {
-                        category = "other"
+                if opts.Sniff {
+                        mimetype.Fill(file)
+                }
+                
+                category, dest := OtherCategory, OtherCategory
+                if rule := classify(rules, file, now, opts.Sniff); rule != nil {
+                        category, dest = rule.Name, rule.Dest
+                }
+                if template != "" {
+                        dest = template
                 }
+                dest = expandDest(dest, category, file)
                 
-                targetDir := filepath.Join(dir, category)
-                targetPath := filepath.Join(targetDir, file.Name)
+                targetDir := filepath.Join(organizeBase(dir, file, opts), dest)
+                entry, err := planMove(file, filepath.Join(targetDir, file.Name), opts.Conflict, claimed)
+                if err != nil {
+                        return organized, err
+                }
+                entry.Category = category
+                entry.Dest = relativeTo(dir, targetDir)
+                if opts.Sniff {
+                        entry.MimeType = file.MimeType
+                        entry.Mismatch = file.Extension != "" && !mimetype.Agrees(file.Extension, file.MimeType)
+                }
+                if opts.Recursive {
+                        entry.Name = relativeTo(dir, file.Path)
+                }
                 
-                organized[category] = append(organized[category], file.Name)
+                organized[category] = append(organized[category], entry)
                 
-                if !dryRun {
-                        // Create directory if it doesn't exist
-                        if err := os.MkdirAll(targetDir, 0755); err != nil {
+                if opts.DryRun || entry.Action == ActionSkip {
+                        continue
+                }
+                
+                if journal == nil {
+                        journal, err = OpenJournal(filepath.Join(dir, JournalName))
+                        if err != nil {
                                 return organized, err
                         }
-                        
-                        // Move the file
-                        if err := os.Rename(file.Path, targetPath); err != nil {
+                        if opts.Run != "" {
+                                journal.run = opts.Run
+                        }
+                        defer journal.Close()
+                }
+                
+                // Create directory if it doesn't exist
+                if err := mkdirAllJournaled(targetDir, journal); err != nil {
+                        return organized, err
+                }
+                
+                // Keep the file being replaced so undo can restore it
+                if entry.Action == ActionOverwrite {
+                        entry.Backup, err = setAside(entry.Target, journal)
+                        if err != nil {
                                 return organized, err
                         }
                 }
+                
+                // Move the file
+                if err := MoveFile(file.Path, entry.Target); err != nil {
+                        return organized, err
+                }
+                
+                if err := journal.Record(models.JournalEntry{
+                        Op:      OpMove,
+                        Path:    file.Path,
+                        Target:  entry.Target,
+                        Size:    file.Size,
+                        ModTime: &file.ModTime,
+                }); err != nil {
+                        return organized, err
+                }
         }
         
         return organized, nil
 }
 
-// GetDirectoryStats calculates comprehensive directory statistics
-func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
+// GetDirectoryStats calculates comprehensive directory statistics,
+// including the opts.TopFiles largest files and opts.TopDirs heaviest
+// subdirectories. Files are not kept once counted, so memory use depends
+// on the depth of the tree and the number of extensions, not its size.
+func GetDirectoryStats(dir string, opts models.StatsOptions) (*models.DirectoryStats, error) {
         stats := &models.DirectoryStats{
                 Path:       dir,
-                FileTypes:  make(map[string]int),
-                Extensions: make(map[string]int),
+                FileTypes:  make(map[string]*models.TypeStats),
+                Extensions: make(map[string]*models.ExtensionStats),
         }
         
+        // Files are grouped into the organize categories, plus source code
+        rules, err := compileRules(statsRules())
+        if err != nil {
+                return nil, err
+        }
+        now := time.Now()
+        
         var largestFile, oldestFile, newestFile *models.FileInfo
+        stats.SizeHistogram = newHistogram(sizeBuckets)
+        stats.AgeHistogram = newHistogram(ageBuckets)
         
-        err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        var dirSizes *dirSizer
+        if opts.TopDirs > 0 {
+                dirSizes = newDirSizer(dir, opts.TopDirs)
+        }
+        
+        err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
                 if err != nil {
                         return err
                 }
@@ -172,6 +339,10 @@ func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
                 
                 fileInfo := models.NewFileInfo(path, info)
                 
+                if dirSizes != nil {
+                        dirSizes.visit(path, info.IsDir(), info.Size())
+                }
+                
                 if info.IsDir() {
                         stats.TotalDirs++
                 } else {
@@ -183,6 +354,14 @@ func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
                                 largestFile = fileInfo
                         }
                         
+                        if opts.TopFiles > 0 {
+                                stats.LargestFiles = insertLargest(stats.LargestFiles, fileInfo, opts.TopFiles)
+                        }
+                        
+                        // Size and age distribution
+                        addToHistogram(stats.SizeHistogram, sizeBuckets, info.Size(), info.Size())
+                        addToHistogram(stats.AgeHistogram, ageBuckets, int64(now.Sub(info.ModTime())), info.Size())
+                        
                         // Track oldest file
                         if oldestFile == nil || info.ModTime().Before(oldestFile.ModTime) {
                                 oldestFile = fileInfo
@@ -195,8 +374,31 @@ func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
                         
                         // Count extensions
                         if fileInfo.Extension != "" {
-                                stats.Extensions[fileInfo.Extension]++
+                                ext := stats.Extensions[fileInfo.Extension]
+                                if ext == nil {
+                                        ext = &models.ExtensionStats{}
+                                        stats.Extensions[fileInfo.Extension] = ext
+                                }
+                                ext.Count++
+                                ext.Size += info.Size()
+                                if ext.LargestFile == "" || info.Size() > ext.LargestSize {
+                                        ext.LargestFile = path
+                                        ext.LargestSize = info.Size()
+                                }
+                        }
+                        
+                        // Count categories
+                        category := OtherCategory
+                        if rule := classify(rules, fileInfo, now, false); rule != nil {
+                                category = rule.Name
                         }
+                        fileType := stats.FileTypes[category]
+                        if fileType == nil {
+                                fileType = &models.TypeStats{}
+                                stats.FileTypes[category] = fileType
+                        }
+                        fileType.Count++
+                        fileType.Size += info.Size()
                 }
                 
                 return nil
@@ -207,6 +409,17 @@ func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
         }
         
         stats.TotalSizeHuman = formatBytes(stats.TotalSize)
+        for _, fileType := range stats.FileTypes {
+                fileType.SizeHuman = formatBytes(fileType.Size)
+        }
+        for _, ext := range stats.Extensions {
+                ext.SizeHuman = formatBytes(ext.Size)
+                ext.AverageSize = ext.Size / int64(ext.Count)
+                ext.AverageHuman = formatBytes(ext.AverageSize)
+        }
+        if dirSizes != nil {
+                stats.LargestDirs = dirSizes.finish()
+        }
         stats.LargestFile = largestFile
         stats.OldestFile = oldestFile
         stats.NewestFile = newestFile
@@ -216,67 +429,56 @@ func GetDirectoryStats(dir string) (*models.DirectoryStats, error) {
 
 // SortFiles sorts files by various criteria
 func SortFiles(files []*models.FileInfo, sortBy string, reverse bool) {
+        less := fileLess(sortBy, reverse)
+        if less == nil {
+                return
+        }
+        sort.Slice(files, func(i, j int) bool {
+                return less(files[i], files[j])
+        })
+}
+
+// fileLess returns the ordering SortFiles uses for sortBy, or nil when
+// files are left in the order they were found
+func fileLess(sortBy string, reverse bool) func(a, b *models.FileInfo) bool {
+        var less func(a, b *models.FileInfo) bool
+        
         switch sortBy {
         case "name":
-                sort.Slice(files, func(i, j int) bool {
-                        result := strings.Compare(files[i].Name, files[j].Name) < 0
-                        if reverse {
-                                return !result
-                        }
-                        return result
-                })
+                less = func(a, b *models.FileInfo) bool { return strings.Compare(a.Name, b.Name) < 0 }
         case "size":
-                sort.Slice(files, func(i, j int) bool {
-                        result := files[i].Size < files[j].Size
-                        if reverse {
-                                return !result
-                        }
-                        return result
-                })
+                less = func(a, b *models.FileInfo) bool { return a.Size < b.Size }
         case "modified":
-                sort.Slice(files, func(i, j int) bool {
-                        result := files[i].ModTime.Before(files[j].ModTime)
-                        if reverse {
-                                return !result
-                        }
-                        return result
-                })
+                less = func(a, b *models.FileInfo) bool { return a.ModTime.Before(b.ModTime) }
         case "extension":
-                sort.Slice(files, func(i, j int) bool {
-                        result := strings.Compare(files[i].Extension, files[j].Extension) < 0
-                        if reverse {
-                                return !result
-                        }
-                        return result
-                })
+                less = func(a, b *models.FileInfo) bool { return strings.Compare(a.Extension, b.Extension) < 0 }
+        default:
+                return nil
         }
+        
+        if reverse {
+                return func(a, b *models.FileInfo) bool { return less(b, a) }
+        }
+        return less
 }
 
-// Helper functions
-
-func matchesPattern(file *models.FileInfo, opts models.SearchOptions) bool {
-        // Pattern matching
-        if opts.Pattern != "" {
-                matched, err := filepath.Match(opts.Pattern, file.Name)
-                if err != nil || !matched {
-                        // Try substring match if glob pattern fails
-                        if !strings.Contains(strings.ToLower(file.Name), strings.ToLower(opts.Pattern)) {
-                                return false
-                        }
-                }
-        }
-        
+// MatchesFilters reports whether a file passes the extension, size, date,
+// MIME type and expression filters of opts. Size filters only apply to
+// files.
+func MatchesFilters(file *models.FileInfo, opts models.SearchOptions) bool {
         // Extension filter
         if opts.Extension != "" && strings.ToLower(file.Extension) != strings.ToLower(opts.Extension) {
                 return false
         }
         
         // Size filters
-        if opts.MinSize > 0 && file.Size < opts.MinSize {
-                return false
-        }
-        if opts.MaxSize > 0 && file.Size > opts.MaxSize {
-                return false
+        if !file.IsDir {
+                if opts.MinSize > 0 && file.Size < opts.MinSize {
+                        return false
+                }
+                if opts.MaxSize > 0 && file.Size > opts.MaxSize {
+                        return false
+                }
         }
         
         // Date filters
@@ -287,6 +489,16 @@ func matchesPattern(file *models.FileInfo, opts models.SearchOptions) bool {
                 return false
         }
         
+        // MIME filter, which reads the start of the file
+        if opts.MimeType != "" && !mimetype.Match(opts.MimeType, mimetype.Fill(file)) {
+                return false
+        }
+        
+        // Expression filter
+        if opts.Filter != nil && !opts.Filter(file) {
+                return false
+        }
+        
         return true
 }
 
@@ -0,0 +1,233 @@
+package fileops
+
+import (
+        "io/fs"
+        "os"
+        "path/filepath"
+        "regexp"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+// collectOrganizeFiles returns the regular files to organize under dir.
+// Non-recursive runs only consider dir itself; recursive runs descend up
+// to opts.MaxDepth levels (0 = unlimited), skipping hidden directories and
+// category directories (see categoryDirs).
+func collectOrganizeFiles(dir string, opts models.OrganizeOptions, rules []*compiledRule, template string) ([]*models.FileInfo, error) {
+        if len(opts.Paths) > 0 {
+                return collectOrganizePaths(dir, opts, rules, template), nil
+        }
+        if !opts.Recursive {
+                return ListFiles(dir, false, false)
+        }
+
+        created, names := categoryDirs(dir, rules, template)
+        var files []*models.FileInfo
+
+        err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+                if err != nil {
+                        return err
+                }
+                if path == dir {
+                        return nil
+                }
+
+                if strings.HasPrefix(d.Name(), ".") {
+                        if d.IsDir() {
+                                return filepath.SkipDir
+                        }
+                        return nil
+                }
+
+                if d.IsDir() {
+                        rel, _ := filepath.Rel(dir, path)
+                        depth := strings.Count(rel, string(filepath.Separator)) + 1
+                        if (opts.MaxDepth > 0 && depth >= opts.MaxDepth) || names.has(d.Name()) || created[absPath(path)] {
+                                return filepath.SkipDir
+                        }
+                        return nil
+                }
+
+                info, err := d.Info()
+                if err != nil {
+                        return err
+                }
+                files = append(files, models.NewFileInfo(path, info))
+                return nil
+        })
+
+        return files, err
+}
+
+// collectOrganizePaths returns the files among opts.Paths that a full run
+// would organize, applying the same depth, hidden and category directory
+// rules. Paths that no longer exist are ignored.
+func collectOrganizePaths(dir string, opts models.OrganizeOptions, rules []*compiledRule, template string) []*models.FileInfo {
+        created, names := categoryDirs(dir, rules, template)
+        var files []*models.FileInfo
+
+        for _, path := range opts.Paths {
+                rel, err := filepath.Rel(dir, path)
+                if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+                        continue
+                }
+
+                segments := strings.Split(rel, string(filepath.Separator))
+                if !opts.Recursive && len(segments) > 1 {
+                        continue
+                }
+                if opts.MaxDepth > 0 && len(segments) > opts.MaxDepth {
+                        continue
+                }
+
+                skip := false
+                parent := dir
+                for i, segment := range segments {
+                        if strings.HasPrefix(segment, ".") {
+                                skip = true
+                                break
+                        }
+                        if i == len(segments)-1 {
+                                break
+                        }
+                        parent = filepath.Join(parent, segment)
+                        if names.has(segment) || created[absPath(parent)] {
+                                skip = true
+                                break
+                        }
+                }
+                if skip {
+                        continue
+                }
+
+                info, err := os.Lstat(path)
+                if err != nil || !info.Mode().IsRegular() {
+                        continue
+                }
+                files = append(files, models.NewFileInfo(path, info))
+        }
+
+        return files
+}
+
+// categoryDirs identifies directories that already hold organized files,
+// so recursive runs do not organize them again: directories recorded as
+// created in dir's journal (by absolute path) and directories named like
+// the first level of a destination (by name, at any depth). Destinations
+// are every rule's and the template, if any, that overrides them.
+func categoryDirs(dir string, rules []*compiledRule, template string) (map[string]bool, *categoryNames) {
+        created := make(map[string]bool)
+        if entries, err := ReadJournal(filepath.Join(dir, JournalName)); err == nil {
+                for _, entry := range entries {
+                        if entry.Op == OpMkdir {
+                                created[absPath(entry.Path)] = true
+                        }
+                }
+        }
+
+        names := &categoryNames{fixed: map[string]bool{OtherCategory: true}}
+        categories := []string{OtherCategory}
+        for _, rule := range rules {
+                names.add(rule.Dest, []string{rule.Name})
+                categories = append(categories, rule.Name)
+        }
+        if template != "" {
+                names.add(template, categories)
+        }
+
+        return created, names
+}
+
+// categoryNames matches the names of directories organize files into
+type categoryNames struct {
+        fixed    map[string]bool
+        patterns []*regexp.Regexp
+}
+
+// namePatterns are what the date placeholders expand to
+var namePatterns = map[string]string{
+        "year":  `\d{4}`,
+        "month": `\d{2}`,
+        "day":   `\d{2}`,
+        "date":  `\d{4}-\d{2}-\d{2}`,
+}
+
+// add matches the first level of dest, such as "images", the "code" in
+// "code/{ext}" or any four-digit name for "{year}/{month}". {category}
+// stands for one of categories. A level using {ext} or {name} could be
+// any name, so it is not matched.
+func (c *categoryNames) add(dest string, categories []string) {
+        root := strings.Split(filepath.ToSlash(dest), "/")[0]
+        if root == "" {
+                return
+        }
+        if !strings.Contains(root, "{") {
+                c.fixed[root] = true
+                return
+        }
+
+        var expr strings.Builder
+        expr.WriteString("^")
+        last := 0
+        for _, m := range destPlaceholder.FindAllStringSubmatchIndex(root, -1) {
+                expr.WriteString(regexp.QuoteMeta(root[last:m[0]]))
+                last = m[1]
+
+                placeholder := root[m[2]:m[3]]
+                if placeholder == "category" {
+                        quoted := make([]string, len(categories))
+                        for i, category := range categories {
+                                quoted[i] = regexp.QuoteMeta(category)
+                        }
+                        expr.WriteString("(" + strings.Join(quoted, "|") + ")")
+                        continue
+                }
+                pattern, ok := namePatterns[placeholder]
+                if !ok {
+                        return
+                }
+                expr.WriteString(pattern)
+        }
+        expr.WriteString(regexp.QuoteMeta(root[last:]) + "$")
+
+        c.patterns = append(c.patterns, regexp.MustCompile(expr.String()))
+}
+
+// has reports whether a directory name is one organize files into
+func (c *categoryNames) has(name string) bool {
+        if c.fixed[name] {
+                return true
+        }
+        for _, pattern := range c.patterns {
+                if pattern.MatchString(name) {
+                        return true
+                }
+        }
+        return false
+}
+
+// organizeBase returns the directory a file is organized within: the top
+// directory when flattening, otherwise the file's own directory
+func organizeBase(dir string, file *models.FileInfo, opts models.OrganizeOptions) string {
+        if opts.Flatten {
+                return dir
+        }
+        return filepath.Dir(file.Path)
+}
+
+// relativeTo returns path relative to dir using forward slashes
+func relativeTo(dir, path string) string {
+        rel, err := filepath.Rel(dir, path)
+        if err != nil {
+                return filepath.ToSlash(path)
+        }
+        return filepath.ToSlash(rel)
+}
+
+func absPath(path string) string {
+        if abs, err := filepath.Abs(path); err == nil {
+                return abs
+        }
+        return filepath.Clean(path)
+}
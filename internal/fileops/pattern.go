@@ -0,0 +1,131 @@
+package fileops
+
+import (
+        "fmt"
+        "path"
+        "regexp"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+// Pattern modes accepted by SearchOptions.PatternMode
+const (
+        // PatternGlob matches a glob against the file name. A pattern without
+        // glob metacharacters matches any name containing it.
+        PatternGlob = "glob"
+        // PatternPath matches a glob supporting ** against the slash-separated
+        // path relative to the search root
+        PatternPath = "path"
+        // PatternRegex matches an RE2 regular expression against the file name
+        PatternRegex = "regex"
+        // PatternLiteral matches names containing the pattern verbatim
+        PatternLiteral = "literal"
+)
+
+// PatternModes lists the supported pattern modes
+var PatternModes = []string{PatternGlob, PatternPath, PatternRegex, PatternLiteral}
+
+// nameMatcher reports whether a file matches the search pattern.
+// relPath is the slash-separated path relative to the search root.
+type nameMatcher func(file *models.FileInfo, relPath string) bool
+
+// compileNameMatcher validates the search pattern and builds its matcher.
+// Malformed patterns are reported as errors rather than silently treated
+// as substrings.
+func compileNameMatcher(opts models.SearchOptions) (nameMatcher, error) {
+        pattern := opts.Pattern
+        if pattern == "" {
+                return func(*models.FileInfo, string) bool { return true }, nil
+        }
+
+        fold := func(s string) string { return s }
+        if !opts.CaseSensitive {
+                fold = strings.ToLower
+                if opts.PatternMode != PatternRegex {
+                        pattern = strings.ToLower(pattern)
+                }
+        }
+
+        switch opts.PatternMode {
+        case "", PatternGlob:
+                if !strings.ContainsAny(pattern, `*?[\`) {
+                        return func(file *models.FileInfo, _ string) bool {
+                                return strings.Contains(fold(file.Name), pattern)
+                        }, nil
+                }
+                if _, err := path.Match(pattern, ""); err != nil {
+                        return nil, fmt.Errorf("invalid glob pattern %q: %w", opts.Pattern, err)
+                }
+                return func(file *models.FileInfo, _ string) bool {
+                        matched, _ := path.Match(pattern, fold(file.Name))
+                        return matched
+                }, nil
+
+        case PatternPath:
+                segments := strings.Split(strings.Trim(pattern, "/"), "/")
+                for _, segment := range segments {
+                        if segment == "**" {
+                                continue
+                        }
+                        if _, err := path.Match(segment, ""); err != nil {
+                                return nil, fmt.Errorf("invalid path pattern %q: %w", opts.Pattern, err)
+                        }
+                }
+                return func(_ *models.FileInfo, relPath string) bool {
+                        return matchSegments(segments, strings.Split(fold(relPath), "/"))
+                }, nil
+
+        case PatternRegex:
+                expr := pattern
+                if !opts.CaseSensitive {
+                        expr = "(?i)" + expr
+                }
+                re, err := regexp.Compile(expr)
+                if err != nil {
+                        return nil, fmt.Errorf("invalid regex pattern: %w", err)
+                }
+                return func(file *models.FileInfo, _ string) bool {
+                        return re.MatchString(file.Name)
+                }, nil
+
+        case PatternLiteral:
+                return func(file *models.FileInfo, _ string) bool {
+                        return strings.Contains(fold(file.Name), pattern)
+                }, nil
+        }
+
+        return nil, fmt.Errorf("unknown pattern mode %q (expected one of: %s)",
+                opts.PatternMode, strings.Join(PatternModes, ", "))
+}
+
+// matchSegments matches path segments against glob segments, where a "**"
+// segment matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+        for len(pattern) > 0 {
+                if pattern[0] == "**" {
+                        for len(pattern) > 0 && pattern[0] == "**" {
+                                pattern = pattern[1:]
+                        }
+                        if len(pattern) == 0 {
+                                return true
+                        }
+                        for i := 0; i <= len(segments); i++ {
+                                if matchSegments(pattern, segments[i:]) {
+                                        return true
+                                }
+                        }
+                        return false
+                }
+
+                if len(segments) == 0 {
+                        return false
+                }
+                if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+                        return false
+                }
+                pattern, segments = pattern[1:], segments[1:]
+        }
+
+        return len(segments) == 0
+}
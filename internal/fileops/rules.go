@@ -0,0 +1,424 @@
+package fileops
+
+import (
+        "encoding/json"
+        "fmt"
+        "os"
+        "path"
+        "path/filepath"
+        "regexp"
+        "sort"
+        "strings"
+        "time"
+
+        "github.com/user/filer/internal/mimetype"
+        "github.com/user/filer/internal/models"
+        "github.com/user/filer/internal/units"
+)
+
+// RulesFileName is the per-directory organize rules file
+const RulesFileName = ".filer-rules.json"
+
+// OtherCategory receives files that no rule matches
+const OtherCategory = "other"
+
+// Organize layouts
+const (
+        // LayoutType files each category into its rule's destination
+        LayoutType = "type"
+        // LayoutDate files everything by date using DefaultDateTemplate
+        LayoutDate = "date"
+)
+
+// DefaultDateTemplate is the destination template of the date layout
+const DefaultDateTemplate = "{year}/{month}"
+
+// Kinds of issues reported by ValidateRules
+const (
+        IssueUnreachable = "unreachable"
+        IssueOverlap     = "overlap"
+)
+
+// DefaultRules returns the built-in extension-based rules
+func DefaultRules() []models.OrganizeRule {
+        return []models.OrganizeRule{
+                {Name: "images", Extensions: []string{"jpg", "jpeg", "png", "gif", "bmp"}},
+                {Name: "videos", Extensions: []string{"mp4", "avi", "mov", "mkv", "wmv"}},
+                {Name: "audio", Extensions: []string{"mp3", "wav", "flac", "aac", "ogg"}},
+                {Name: "documents", Extensions: []string{"pdf", "doc", "docx", "txt", "xls", "xlsx", "ppt", "pptx"}},
+                {Name: "archives", Extensions: []string{"zip", "rar", "tar", "gz", "7z"}},
+        }
+}
+
+// statsRules returns the categories stats groups files into: the built-in
+// organize rules plus source code, which organize leaves in other
+func statsRules() []models.OrganizeRule {
+        return append(DefaultRules(),
+                models.OrganizeRule{Name: "code", Extensions: []string{"go", "py", "js", "ts", "java", "c", "h", "cpp", "hpp", "cs", "rb", "rs", "php", "swift", "kt", "sh", "html", "css"}})
+}
+
+// FindRulesFile returns the rules file that applies to dir: a
+// .filer-rules.json inside dir, then rules.json in the user's filer config
+// directory. It returns "" when neither exists.
+func FindRulesFile(dir string) string {
+        candidates := []string{filepath.Join(dir, RulesFileName)}
+        if configDir, err := os.UserConfigDir(); err == nil {
+                candidates = append(candidates, filepath.Join(configDir, "filer", "rules.json"))
+        }
+
+        for _, candidate := range candidates {
+                if _, err := os.Stat(candidate); err == nil {
+                        return candidate
+                }
+        }
+        return ""
+}
+
+// LoadRules reads organize rules from a JSON rules file
+func LoadRules(path string) ([]models.OrganizeRule, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+
+        var config models.RulesConfig
+        if err := json.Unmarshal(data, &config); err != nil {
+                return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+        }
+        if len(config.Rules) == 0 {
+                return nil, fmt.Errorf("rules file %s defines no rules", path)
+        }
+
+        return config.Rules, nil
+}
+
+// compiledRule is an OrganizeRule with its criteria parsed
+type compiledRule struct {
+        models.OrganizeRule
+        exts      map[string]bool
+        mimes     map[string]bool
+        re        *regexp.Regexp
+        minSize   int64
+        maxSize   int64
+        olderThan time.Duration
+        newerThan time.Duration
+}
+
+// compileRules validates and parses rules, reporting the first invalid one
+func compileRules(rules []models.OrganizeRule) ([]*compiledRule, error) {
+        compiled := make([]*compiledRule, 0, len(rules))
+
+        for i, rule := range rules {
+                c, err := compileRule(rule)
+                if err != nil {
+                        return nil, fmt.Errorf("rule %d (%s): %w", i+1, rule.Name, err)
+                }
+                compiled = append(compiled, c)
+        }
+
+        return compiled, nil
+}
+
+func compileRule(rule models.OrganizeRule) (*compiledRule, error) {
+        c := &compiledRule{OrganizeRule: rule, exts: make(map[string]bool), mimes: make(map[string]bool)}
+        var err error
+
+        if rule.Name == "" {
+                return nil, fmt.Errorf("missing name")
+        }
+        if c.Dest == "" {
+                c.Dest = "{category}"
+        }
+        if err := checkDestTemplate(c.Dest); err != nil {
+                return nil, err
+        }
+
+        for _, ext := range rule.Extensions {
+                ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+                c.exts[ext] = true
+                if mimeType := mimetype.FromExtension(ext); mimeType != mimetype.Unknown {
+                        c.mimes[mimeType] = true
+                }
+        }
+
+        if rule.Glob != "" {
+                if _, err := path.Match(strings.ToLower(rule.Glob), ""); err != nil {
+                        return nil, fmt.Errorf("invalid glob %q: %w", rule.Glob, err)
+                }
+        }
+        if rule.Regex != "" {
+                if c.re, err = regexp.Compile(rule.Regex); err != nil {
+                        return nil, fmt.Errorf("invalid regex: %w", err)
+                }
+        }
+        if rule.MimeType != "" {
+                if _, err := path.Match(rule.MimeType, ""); err != nil {
+                        return nil, fmt.Errorf("invalid MIME type pattern %q: %w", rule.MimeType, err)
+                }
+        }
+
+        if rule.MinSize != "" {
+                if c.minSize, err = units.ParseSize(rule.MinSize); err != nil {
+                        return nil, err
+                }
+        }
+        if rule.MaxSize != "" {
+                if c.maxSize, err = units.ParseSize(rule.MaxSize); err != nil {
+                        return nil, err
+                }
+        }
+        if rule.OlderThan != "" {
+                if c.olderThan, err = units.ParseDuration(rule.OlderThan); err != nil {
+                        return nil, err
+                }
+        }
+        if rule.NewerThan != "" {
+                if c.newerThan, err = units.ParseDuration(rule.NewerThan); err != nil {
+                        return nil, err
+                }
+        }
+
+        return c, nil
+}
+
+// matches reports whether a file satisfies every criterion of the rule.
+// With sniff, file.MimeType holds the detected content type, which takes
+// precedence over the extension.
+func (r *compiledRule) matches(file *models.FileInfo, now time.Time, sniff bool) bool {
+        if len(r.exts) > 0 && !r.matchesExtension(file, sniff) {
+                return false
+        }
+        if r.Glob != "" {
+                if matched, _ := path.Match(strings.ToLower(r.Glob), strings.ToLower(file.Name)); !matched {
+                        return false
+                }
+        }
+        if r.re != nil && !r.re.MatchString(file.Name) {
+                return false
+        }
+        if r.minSize > 0 && file.Size < r.minSize {
+                return false
+        }
+        if r.maxSize > 0 && file.Size > r.maxSize {
+                return false
+        }
+
+        age := now.Sub(file.ModTime)
+        if r.olderThan > 0 && age <= r.olderThan {
+                return false
+        }
+        if r.newerThan > 0 && age >= r.newerThan {
+                return false
+        }
+
+        if r.MimeType != "" {
+                if matched, _ := path.Match(r.MimeType, mimeTypeOf(file)); !matched {
+                        return false
+                }
+        }
+
+        return true
+}
+
+// matchesExtension checks a file against the rule's extensions. When
+// sniffing, the extension only counts if the contents agree with it, and a
+// file whose contents have the type of one of the extensions matches too.
+func (r *compiledRule) matchesExtension(file *models.FileInfo, sniff bool) bool {
+        ext := strings.ToLower(file.Extension)
+        if !sniff {
+                return r.exts[ext]
+        }
+        if r.exts[ext] && mimetype.Agrees(ext, file.MimeType) {
+                return true
+        }
+        return r.mimes[file.MimeType]
+}
+
+// mimeTypeOf returns a file's MIME type: the detected one if it has been
+// sniffed, otherwise the one implied by its extension
+func mimeTypeOf(file *models.FileInfo) string {
+        if file.MimeType != "" {
+                return file.MimeType
+        }
+
+        return mimetype.FromExtension(file.Extension)
+}
+
+// classify returns the first rule matching file, or nil
+func classify(rules []*compiledRule, file *models.FileInfo, now time.Time, sniff bool) *compiledRule {
+        for _, rule := range rules {
+                if rule.matches(file, now, sniff) {
+                        return rule
+                }
+        }
+        return nil
+}
+
+// destPlaceholder matches {placeholders} in destination templates
+var destPlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// destContext carries what destination placeholders are expanded from.
+// The file's date is only looked up when a template needs it.
+type destContext struct {
+        category string
+        file     *models.FileInfo
+        date     *time.Time
+}
+
+// fileDate returns when the file's content was created: the EXIF
+// DateTimeOriginal for JPEGs that have one, otherwise the modification time
+func (c *destContext) fileDate() time.Time {
+        if c.date == nil {
+                date := c.file.ModTime
+                ext := strings.ToLower(c.file.Extension)
+                if ext == "jpg" || ext == "jpeg" {
+                        if taken, ok := exifDateTaken(c.file.Path); ok {
+                                date = taken
+                        }
+                }
+                c.date = &date
+        }
+        return *c.date
+}
+
+// destFields lists the placeholders available in destination templates
+var destFields = map[string]func(c *destContext) string{
+        "category": func(c *destContext) string { return c.category },
+        "ext": func(c *destContext) string {
+                if c.file.Extension == "" {
+                        return "none"
+                }
+                return strings.ToLower(c.file.Extension)
+        },
+        "name": func(c *destContext) string {
+                return strings.TrimSuffix(c.file.Name, filepath.Ext(c.file.Name))
+        },
+        "year":  func(c *destContext) string { return c.fileDate().Format("2006") },
+        "month": func(c *destContext) string { return c.fileDate().Format("01") },
+        "day":   func(c *destContext) string { return c.fileDate().Format("02") },
+        "date":  func(c *destContext) string { return c.fileDate().Format("2006-01-02") },
+}
+
+// checkDestTemplate rejects unknown placeholders and destinations that
+// would escape the organized directory
+func checkDestTemplate(dest string) error {
+        for _, m := range destPlaceholder.FindAllStringSubmatch(dest, -1) {
+                if destFields[m[1]] == nil {
+                        names := make([]string, 0, len(destFields))
+                        for name := range destFields {
+                                names = append(names, "{"+name+"}")
+                        }
+                        sort.Strings(names)
+                        return fmt.Errorf("unknown placeholder %s in destination (expected one of: %s)",
+                                m[0], strings.Join(names, ", "))
+                }
+        }
+
+        cleaned := path.Clean(filepath.ToSlash(dest))
+        if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+                return fmt.Errorf("destination %q must stay inside the organized directory", dest)
+        }
+        return nil
+}
+
+// expandDest fills in a destination template for a file
+func expandDest(dest, category string, file *models.FileInfo) string {
+        ctx := &destContext{category: category, file: file}
+        expanded := destPlaceholder.ReplaceAllStringFunc(dest, func(m string) string {
+                return destFields[m[1:len(m)-1]](ctx)
+        })
+        return filepath.FromSlash(expanded)
+}
+
+// ValidateRules checks rules for errors, for rules that can never match
+// because an earlier rule catches everything they would, and for rules
+// whose extensions overlap with an earlier rule
+func ValidateRules(rules []models.OrganizeRule) ([]models.RuleIssue, error) {
+        compiled, err := compileRules(rules)
+        if err != nil {
+                return nil, err
+        }
+
+        var issues []models.RuleIssue
+
+        for j, later := range compiled {
+                for i, earlier := range compiled[:j] {
+                        if shadows(earlier, later) {
+                                issues = append(issues, models.RuleIssue{
+                                        Rule: j + 1,
+                                        Name: later.Name,
+                                        Kind: IssueUnreachable,
+                                        Message: fmt.Sprintf("every file it matches is already matched by rule %d (%s)",
+                                                i+1, earlier.Name),
+                                })
+                                break
+                        }
+
+                        if shared := sharedExtensions(earlier, later); len(shared) > 0 {
+                                issues = append(issues, models.RuleIssue{
+                                        Rule: j + 1,
+                                        Name: later.Name,
+                                        Kind: IssueOverlap,
+                                        Message: fmt.Sprintf("extensions %s are also matched by rule %d (%s), which takes precedence",
+                                                strings.Join(shared, ", "), i+1, earlier.Name),
+                                })
+                        }
+                }
+        }
+
+        return issues, nil
+}
+
+// shadows reports whether every file matching b also matches a, i.e. each
+// criterion of a is absent or no stricter than the same criterion of b
+func shadows(a, b *compiledRule) bool {
+        if len(a.exts) > 0 {
+                if len(b.exts) == 0 {
+                        return false
+                }
+                for ext := range b.exts {
+                        if !a.exts[ext] {
+                                return false
+                        }
+                }
+        }
+
+        if a.Glob != "" && !strings.EqualFold(a.Glob, b.Glob) {
+                return false
+        }
+        if a.Regex != "" && a.Regex != b.Regex {
+                return false
+        }
+        if a.MimeType != "" && a.MimeType != b.MimeType {
+                if matched, _ := path.Match(a.MimeType, b.MimeType); b.MimeType == "" || !matched {
+                        return false
+                }
+        }
+
+        if a.minSize > 0 && b.minSize < a.minSize {
+                return false
+        }
+        if a.maxSize > 0 && (b.maxSize == 0 || b.maxSize > a.maxSize) {
+                return false
+        }
+        if a.olderThan > 0 && b.olderThan < a.olderThan {
+                return false
+        }
+        if a.newerThan > 0 && (b.newerThan == 0 || b.newerThan > a.newerThan) {
+                return false
+        }
+
+        return true
+}
+
+// sharedExtensions lists the extensions explicitly matched by both rules
+func sharedExtensions(a, b *compiledRule) []string {
+        var shared []string
+        for ext := range b.exts {
+                if a.exts[ext] {
+                        shared = append(shared, ext)
+                }
+        }
+        sort.Strings(shared)
+        return shared
+}
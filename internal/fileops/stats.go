@@ -0,0 +1,160 @@
+package fileops
+
+import (
+        "path/filepath"
+        "sort"
+        "strings"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// bucket is one range of a histogram, holding values below limit
+// (or any value when limit is 0)
+type bucket struct {
+        label string
+        limit int64
+}
+
+// sizeBuckets divide files by size in bytes
+var sizeBuckets = []bucket{
+        {"0", 1},
+        {"<1K", 1 << 10},
+        {"<1M", 1 << 20},
+        {"<100M", 100 << 20},
+        {"<1G", 1 << 30},
+        {">1G", 0},
+}
+
+// ageBuckets divide files by time since modification, with months and
+// years approximated as 30 and 365 days
+var ageBuckets = []bucket{
+        {"<1d", int64(24 * time.Hour)},
+        {"<1w", int64(7 * 24 * time.Hour)},
+        {"<1m", int64(30 * 24 * time.Hour)},
+        {"<1y", int64(365 * 24 * time.Hour)},
+        {"older", 0},
+}
+
+// newHistogram returns an empty histogram with the given buckets
+func newHistogram(buckets []bucket) []models.HistogramBucket {
+        histogram := make([]models.HistogramBucket, len(buckets))
+        for i, b := range buckets {
+                histogram[i].Label = b.label
+        }
+        return histogram
+}
+
+// addToHistogram counts a file of the given size in the bucket value falls
+// into
+func addToHistogram(histogram []models.HistogramBucket, buckets []bucket, value, size int64) {
+        for i, b := range buckets {
+                if b.limit == 0 || value < b.limit {
+                        histogram[i].Count++
+                        histogram[i].Size += size
+                        return
+                }
+        }
+}
+
+// insertLargest adds file to largest, which is kept sorted by size
+// (largest first) and holds at most n files
+func insertLargest(largest []*models.FileInfo, file *models.FileInfo, n int) []*models.FileInfo {
+        if len(largest) == n && file.Size <= largest[n-1].Size {
+                return largest
+        }
+
+        i := sort.Search(len(largest), func(i int) bool {
+                return largest[i].Size < file.Size
+        })
+        if len(largest) < n {
+                largest = append(largest, nil)
+        }
+        copy(largest[i+1:], largest[i:])
+        largest[i] = file
+        return largest
+}
+
+// dirSizer computes du-style recursive directory sizes during a
+// depth-first walk. It only keeps the directories on the current path and
+// the n largest seen so far, so memory does not grow with the tree.
+type dirSizer struct {
+        root    string
+        n       int
+        open    []*models.DirSize
+        largest []*models.DirSize
+}
+
+func newDirSizer(root string, n int) *dirSizer {
+        return &dirSizer{root: root, n: n}
+}
+
+// visit records a path reached by the walk: directories below the root are
+// opened, and files count towards the innermost open directory
+func (s *dirSizer) visit(path string, isDir bool, size int64) {
+        s.closeOutside(path)
+
+        if isDir {
+                if path != s.root {
+                        s.open = append(s.open, &models.DirSize{Path: path})
+                }
+                return
+        }
+
+        if len(s.open) > 0 {
+                dir := s.open[len(s.open)-1]
+                dir.Files++
+                dir.Size += size
+        }
+}
+
+// closeOutside closes the open directories path is not inside, adding
+// their totals to their parents
+func (s *dirSizer) closeOutside(path string) {
+        for len(s.open) > 0 {
+                dir := s.open[len(s.open)-1]
+                if strings.HasPrefix(path, dir.Path+string(filepath.Separator)) {
+                        return
+                }
+
+                s.open = s.open[:len(s.open)-1]
+                if len(s.open) > 0 {
+                        parent := s.open[len(s.open)-1]
+                        parent.Files += dir.Files
+                        parent.Size += dir.Size
+                }
+                if dir.Files > 0 {
+                        s.largest = insertLargestDir(s.largest, dir, s.n)
+                }
+        }
+}
+
+// finish closes every directory and returns the n heaviest
+func (s *dirSizer) finish() []*models.DirSize {
+        s.closeOutside("")
+        for _, dir := range s.largest {
+                dir.SizeHuman = formatBytes(dir.Size)
+        }
+        return s.largest
+}
+
+// insertLargestDir adds dir to largest, which is kept sorted by size
+// (largest first, then by path) and holds at most n directories
+func insertLargestDir(largest []*models.DirSize, dir *models.DirSize, n int) []*models.DirSize {
+        i := sort.Search(len(largest), func(i int) bool {
+                if largest[i].Size != dir.Size {
+                        return largest[i].Size < dir.Size
+                }
+                return largest[i].Path > dir.Path
+        })
+        if i >= n {
+                return largest
+        }
+
+        if len(largest) < n {
+                largest = append(largest, nil)
+        }
+        copy(largest[i+1:], largest[i:])
+        largest[i] = dir
+        return largest
+}
@@ -0,0 +1,92 @@
+package fileops
+
+import (
+        "path/filepath"
+        "sort"
+
+        "github.com/user/filer/internal/models"
+)
+
+// BuildTree arranges a flat listing into a hierarchy rooted at dir.
+// Directories missing from the listing (for example because a filter
+// removed them) are synthesized so every entry keeps its place in the tree.
+// The children of every directory are then ordered as SortFiles would
+// order them for sortBy and reverse, whatever the order of the input; an
+// unknown sortBy (such as "none") keeps the input order.
+func BuildTree(dir string, files []*models.FileInfo, sortBy string, reverse bool) *models.TreeNode {
+        rootPath := filepath.Clean(dir)
+        root := &models.TreeNode{
+                Info: &models.FileInfo{Name: dir, Path: dir, IsDir: true},
+        }
+        nodes := map[string]*models.TreeNode{rootPath: root}
+
+        var ensureDir func(path string) *models.TreeNode
+        ensureDir = func(path string) *models.TreeNode {
+                if node, exists := nodes[path]; exists {
+                        return node
+                }
+
+                parentPath := filepath.Dir(path)
+                parent := root
+                if parentPath != path {
+                        parent = ensureDir(parentPath)
+                }
+
+                node := &models.TreeNode{
+                        Info: &models.FileInfo{Name: filepath.Base(path), Path: path, IsDir: true},
+                }
+                nodes[path] = node
+                parent.Children = append(parent.Children, node)
+                return node
+        }
+
+        for _, file := range files {
+                path := filepath.Clean(file.Path)
+
+                // Replace synthesized placeholders with the real entry
+                if node, exists := nodes[path]; exists {
+                        if path != rootPath {
+                                node.Info = file
+                        }
+                        continue
+                }
+
+                parent := ensureDir(filepath.Dir(path))
+                node := &models.TreeNode{Info: file}
+                if file.IsDir {
+                        nodes[path] = node
+                }
+                parent.Children = append(parent.Children, node)
+        }
+
+        if less := fileLess(sortBy, reverse); less != nil {
+                sortTree(root, less)
+        }
+        summarizeTree(root)
+        return root
+}
+
+// sortTree orders the children of node and of every directory below it
+func sortTree(node *models.TreeNode, less func(a, b *models.FileInfo) bool) {
+        sort.SliceStable(node.Children, func(i, j int) bool {
+                return less(node.Children[i].Info, node.Children[j].Info)
+        })
+        for _, child := range node.Children {
+                sortTree(child, less)
+        }
+}
+
+// summarizeTree fills in item counts and aggregated sizes bottom-up
+func summarizeTree(node *models.TreeNode) {
+        node.ItemCount = len(node.Children)
+        node.TotalSize = 0
+
+        for _, child := range node.Children {
+                if child.Info.IsDir {
+                        summarizeTree(child)
+                        node.TotalSize += child.TotalSize
+                } else {
+                        node.TotalSize += child.Info.Size
+                }
+        }
+}
@@ -0,0 +1,175 @@
+package fileops
+
+import (
+        "fmt"
+        "os"
+        "path/filepath"
+
+        "github.com/user/filer/internal/models"
+)
+
+// UndoOrganize reverses the most recent organize run recorded in a
+// directory's journal. Files are moved back to where they came from unless
+// they changed since (different size or modification time) or their
+// original location is now occupied; Force moves changed files anyway.
+// Files that an overwrite replaced are put back once the file that
+// replaced them has been moved out. Directories the run created are
+// removed if they are empty. Entries that could not be undone stay in the
+// journal so the undo can be retried.
+func UndoOrganize(dir string, opts models.UndoOptions) ([]*models.UndoResult, error) {
+        journalPath := filepath.Join(dir, JournalName)
+        entries, err := ReadJournal(journalPath)
+        if os.IsNotExist(err) {
+                return nil, fmt.Errorf("no organize journal found in %s", dir)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        // Find the most recent run that organize recorded
+        run := ""
+        for _, entry := range entries {
+                if entry.Op == OpMove || entry.Op == OpMkdir || entry.Op == OpOverwrite {
+                        run = entry.Run
+                }
+        }
+        if run == "" {
+                return nil, fmt.Errorf("no organize runs recorded in %s", journalPath)
+        }
+
+        var results []*models.UndoResult
+        failed := make(map[int]bool)
+
+        for i := len(entries) - 1; i >= 0; i-- {
+                entry := entries[i]
+                if entry.Run != run {
+                        continue
+                }
+
+                var result *models.UndoResult
+                switch entry.Op {
+                case OpMove, OpOverwrite:
+                        result = undoMove(entry, opts)
+                case OpMkdir:
+                        result = undoMkdir(entry, opts)
+                default:
+                        continue
+                }
+
+                results = append(results, result)
+                if result.Action == "skip" {
+                        failed[i] = true
+                }
+        }
+
+        if opts.DryRun {
+                return results, nil
+        }
+
+        // Drop the entries that were undone
+        var remaining []models.JournalEntry
+        for i, entry := range entries {
+                if entry.Run != run || failed[i] {
+                        remaining = append(remaining, entry)
+                }
+        }
+
+        return results, WriteJournal(journalPath, remaining)
+}
+
+func undoMove(entry models.JournalEntry, opts models.UndoOptions) *models.UndoResult {
+        result := &models.UndoResult{Action: "restore", Path: entry.Path, From: entry.Target}
+
+        info, err := os.Stat(entry.Target)
+        if err != nil {
+                result.Action, result.Reason = "skip", "file no longer exists"
+                return result
+        }
+        changed := info.Size() != entry.Size || entry.ModTime == nil || !info.ModTime().Equal(*entry.ModTime)
+        if changed && !opts.Force {
+                result.Action, result.Reason = "skip", "changed since organize; use --force to restore anyway"
+                return result
+        }
+        if _, err := os.Lstat(entry.Path); err == nil {
+                result.Action, result.Reason = "skip", "original location is occupied"
+                return result
+        }
+
+        if opts.DryRun {
+                return result
+        }
+
+        if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+                result.Action, result.Reason = "skip", err.Error()
+                return result
+        }
+        if err := MoveFile(entry.Target, entry.Path); err != nil {
+                result.Action, result.Reason = "skip", err.Error()
+        }
+        return result
+}
+
+func undoMkdir(entry models.JournalEntry, opts models.UndoOptions) *models.UndoResult {
+        result := &models.UndoResult{Action: "remove", Path: entry.Path}
+
+        if opts.DryRun {
+                result.Reason = "if empty"
+                return result
+        }
+
+        children, err := os.ReadDir(entry.Path)
+        if os.IsNotExist(err) {
+                result.Action, result.Reason = "keep", "already removed"
+                return result
+        }
+        if err != nil || len(children) > 0 {
+                result.Action, result.Reason = "skip", "directory is not empty"
+                return result
+        }
+
+        if err := os.Remove(entry.Path); err != nil {
+                result.Action, result.Reason = "skip", err.Error()
+        }
+        return result
+}
+
+// CommitOrganize makes every organize run recorded in a directory's journal
+// permanent: the files kept from overwrites are deleted and the runs are
+// removed from the journal, so they can no longer be undone. Entries
+// recorded by other commands are kept.
+func CommitOrganize(dir string, opts models.UndoOptions) ([]*models.UndoResult, error) {
+        journalPath := filepath.Join(dir, JournalName)
+        entries, err := ReadJournal(journalPath)
+        if os.IsNotExist(err) {
+                return nil, fmt.Errorf("no organize journal found in %s", dir)
+        }
+        if err != nil {
+                return nil, err
+        }
+
+        var results []*models.UndoResult
+        var remaining []models.JournalEntry
+
+        for _, entry := range entries {
+                switch entry.Op {
+                case OpOverwrite:
+                        result := &models.UndoResult{Action: "delete", Path: entry.Target, Reason: "overwritten " + filepath.Base(entry.Path)}
+                        results = append(results, result)
+                        if opts.DryRun {
+                                continue
+                        }
+                        if err := os.Remove(entry.Target); err != nil && !os.IsNotExist(err) {
+                                result.Action, result.Reason = "skip", err.Error()
+                                remaining = append(remaining, entry)
+                        }
+                case OpMove, OpMkdir:
+                default:
+                        remaining = append(remaining, entry)
+                }
+        }
+
+        if opts.DryRun {
+                return results, nil
+        }
+        return results, WriteJournal(journalPath, remaining)
+}
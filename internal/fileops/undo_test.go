@@ -0,0 +1,158 @@
+package fileops
+
+import (
+        "os"
+        "path/filepath"
+        "strings"
+        "testing"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// organize runs OrganizeFiles on dir with the given conflict policy
+func organize(t *testing.T, dir, conflict string) map[string][]*models.OrganizeEntry {
+        t.Helper()
+        organized, err := OrganizeFiles(dir, models.OrganizeOptions{Conflict: conflict})
+        if err != nil {
+                t.Fatal(err)
+        }
+        return organized
+}
+
+// undo runs UndoOrganize on dir, failing the test if any entry is skipped
+func undo(t *testing.T, dir string) []*models.UndoResult {
+        t.Helper()
+        results, err := UndoOrganize(dir, models.UndoOptions{})
+        if err != nil {
+                t.Fatal(err)
+        }
+        for _, result := range results {
+                if result.Action == "skip" {
+                        t.Errorf("undo skipped %s: %s", result.Path, result.Reason)
+                }
+        }
+        return results
+}
+
+func TestOrganizeJournal(t *testing.T) {
+        dir := t.TempDir()
+        writeFile(t, filepath.Join(dir, "notes.txt"), "notes", time.Now())
+        organize(t, dir, "")
+
+        entries, err := ReadJournal(filepath.Join(dir, JournalName))
+        if err != nil {
+                t.Fatal(err)
+        }
+        if len(entries) != 2 {
+                t.Fatalf("got %d journal entries, want 2", len(entries))
+        }
+
+        mkdir, move := entries[0], entries[1]
+        if mkdir.Op != OpMkdir || mkdir.Path != filepath.Join(dir, "documents") {
+                t.Errorf("got first entry %+v, want a mkdir of documents", mkdir)
+        }
+        if move.Op != OpMove || move.Path != filepath.Join(dir, "notes.txt") || move.Target != filepath.Join(dir, "documents", "notes.txt") {
+                t.Errorf("got second entry %+v, want a move of notes.txt", move)
+        }
+        if move.Run != mkdir.Run || move.Size != 5 || move.ModTime == nil {
+                t.Errorf("move entry %+v is missing its run, size or modification time", move)
+        }
+
+        // Paths are stored relative to the journal's directory
+        data := readFile(t, filepath.Join(dir, JournalName))
+        if strings.Contains(data, dir) {
+                t.Errorf("journal holds absolute paths:\n%s", data)
+        }
+}
+
+func TestUndoOrganize(t *testing.T) {
+        dir := t.TempDir()
+        writeFile(t, filepath.Join(dir, "notes.txt"), "notes", time.Now())
+        writeFile(t, filepath.Join(dir, "photo.jpg"), "photo", time.Now())
+        organize(t, dir, "")
+
+        undo(t, dir)
+
+        for name, want := range map[string]string{"notes.txt": "notes", "photo.jpg": "photo"} {
+                if got := readFile(t, filepath.Join(dir, name)); got != want {
+                        t.Errorf("%s holds %q, want %q", name, got, want)
+                }
+        }
+        for _, sub := range []string{"documents", "images"} {
+                if _, err := os.Stat(filepath.Join(dir, sub)); !os.IsNotExist(err) {
+                        t.Errorf("directory %s was not removed", sub)
+                }
+        }
+        if _, err := os.Stat(filepath.Join(dir, JournalName)); !os.IsNotExist(err) {
+                t.Error("journal was not removed once every entry was undone")
+        }
+}
+
+func TestUndoOrganizeLatestRun(t *testing.T) {
+        dir := t.TempDir()
+        writeFile(t, filepath.Join(dir, "first.txt"), "first", time.Now())
+        organize(t, dir, "")
+        writeFile(t, filepath.Join(dir, "second.txt"), "second", time.Now())
+        organize(t, dir, "")
+
+        undo(t, dir)
+
+        if _, err := os.Stat(filepath.Join(dir, "second.txt")); err != nil {
+                t.Errorf("second run was not undone: %v", err)
+        }
+        if _, err := os.Stat(filepath.Join(dir, "documents", "first.txt")); err != nil {
+                t.Errorf("first run was undone too: %v", err)
+        }
+
+        undo(t, dir)
+        if got := readFile(t, filepath.Join(dir, "first.txt")); got != "first" {
+                t.Errorf("first.txt holds %q after undoing the first run", got)
+        }
+}
+
+func TestUndoOrganizeSkipsChangedFiles(t *testing.T) {
+        dir := t.TempDir()
+        writeFile(t, filepath.Join(dir, "notes.txt"), "notes", time.Now().Add(-time.Hour))
+        organize(t, dir, "")
+
+        moved := filepath.Join(dir, "documents", "notes.txt")
+        writeFile(t, moved, "edited notes", time.Now())
+
+        results, err := UndoOrganize(dir, models.UndoOptions{})
+        if err != nil {
+                t.Fatal(err)
+        }
+        skipped := 0
+        for _, result := range results {
+                if result.Action == "skip" {
+                        skipped++
+                }
+        }
+        // The move is skipped, so the directory holding the file is kept too
+        if skipped != 2 {
+                t.Errorf("got results %+v, want the move and mkdir skipped", results)
+        }
+        if got := readFile(t, moved); got != "edited notes" {
+                t.Errorf("changed file holds %q", got)
+        }
+
+        entries, err := ReadJournal(filepath.Join(dir, JournalName))
+        if err != nil || len(entries) != 2 {
+                t.Fatalf("journal holds %d entries (%v), want the 2 that were skipped", len(entries), err)
+        }
+
+        // Force restores it anyway
+        if _, err := UndoOrganize(dir, models.UndoOptions{Force: true}); err != nil {
+                t.Fatal(err)
+        }
+        if got := readFile(t, filepath.Join(dir, "notes.txt")); got != "edited notes" {
+                t.Errorf("forced undo left notes.txt holding %q", got)
+        }
+}
+
+func TestUndoOrganizeWithoutJournal(t *testing.T) {
+        if _, err := UndoOrganize(t.TempDir(), models.UndoOptions{}); err == nil {
+                t.Error("expected an error for a directory without a journal")
+        }
+}
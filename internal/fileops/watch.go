@@ -0,0 +1,271 @@
+package fileops
+
+import (
+        "errors"
+        "fmt"
+        "io/fs"
+        "os"
+        "path/filepath"
+        "strings"
+        "sync"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// Watch event operations
+const (
+        EventCreate = "create"
+        EventModify = "modify"
+        EventDelete = "delete"
+        EventRename = "rename"
+)
+
+// Watch backends
+const (
+        BackendNative  = "inotify"
+        BackendPolling = "polling"
+)
+
+// ErrEventsLost is sent on a Watcher's Errors channel when the system
+// dropped events, so changes were missed until the tree is rescanned
+var ErrEventsLost = errors.New("watch event queue overflowed; some changes were missed")
+
+// WatchOptions controls how a directory tree is watched
+type WatchOptions struct {
+        Recursive     bool
+        IncludeHidden bool
+        ForcePolling  bool
+        PollInterval  time.Duration
+}
+
+// Watcher streams changes in a directory tree. It uses inotify where
+// available and otherwise polls the tree, comparing snapshots.
+type Watcher struct {
+        Events  <-chan models.WatchEvent
+        Errors  <-chan error
+        Backend string
+
+        done      chan struct{}
+        closeOnce sync.Once
+        closeFn   func() error
+}
+
+// NewWatcher starts watching root
+func NewWatcher(root string, opts WatchOptions) (*Watcher, error) {
+        if info, err := os.Stat(root); err != nil {
+                return nil, err
+        } else if !info.IsDir() {
+                return nil, fmt.Errorf("%s is not a directory", root)
+        }
+
+        if !opts.ForcePolling {
+                if w, err := newNativeWatcher(root, opts); err == nil {
+                        return w, nil
+                }
+        }
+        return newPollingWatcher(root, opts)
+}
+
+// Close stops the watcher and closes its channels
+func (w *Watcher) Close() error {
+        var err error
+        w.closeOnce.Do(func() {
+                close(w.done)
+                if w.closeFn != nil {
+                        err = w.closeFn()
+                }
+        })
+        return err
+}
+
+// skipWatchPath reports whether a path inside root is excluded from watching
+func skipWatchPath(root, path string, opts WatchOptions) bool {
+        if path == root {
+                return false
+        }
+        if !opts.IncludeHidden && strings.HasPrefix(filepath.Base(path), ".") {
+                return true
+        }
+        if !opts.Recursive && filepath.Dir(path) != filepath.Clean(root) {
+                return true
+        }
+        return false
+}
+
+// NewEventFilter builds a predicate selecting the watch events whose path
+// (or previous path, for renames) matches the pattern and extension in
+// opts. Size and date criteria are not applied since deleted files cannot
+// be inspected.
+func NewEventFilter(root string, opts models.SearchOptions) (func(event models.WatchEvent) bool, error) {
+        matchName, err := compileNameMatcher(opts)
+        if err != nil {
+                return nil, err
+        }
+
+        matchPath := func(path string, isDir bool) bool {
+                name := filepath.Base(path)
+                file := &models.FileInfo{
+                        Name:      name,
+                        Path:      path,
+                        IsDir:     isDir,
+                        Extension: strings.TrimPrefix(filepath.Ext(name), "."),
+                }
+
+                if opts.Extension != "" && !strings.EqualFold(file.Extension, opts.Extension) {
+                        return false
+                }
+
+                rel, err := filepath.Rel(root, path)
+                if err != nil {
+                        rel = path
+                }
+                return matchName(file, filepath.ToSlash(rel))
+        }
+
+        return func(event models.WatchEvent) bool {
+                if matchPath(event.Path, event.IsDir) {
+                        return true
+                }
+                return event.OldPath != "" && matchPath(event.OldPath, event.IsDir)
+        }, nil
+}
+
+// pollSnapshot is what the polling backend remembers about a path
+type pollSnapshot struct {
+        size    int64
+        modTime time.Time
+        isDir   bool
+}
+
+func newPollingWatcher(root string, opts WatchOptions) (*Watcher, error) {
+        interval := opts.PollInterval
+        if interval <= 0 {
+                interval = time.Second
+        }
+
+        before, err := pollTree(root, opts)
+        if err != nil {
+                return nil, err
+        }
+
+        events := make(chan models.WatchEvent, 256)
+        errs := make(chan error, 1)
+        w := &Watcher{Events: events, Errors: errs, Backend: BackendPolling, done: make(chan struct{})}
+
+        go func() {
+                defer close(events)
+                defer close(errs)
+
+                ticker := time.NewTicker(interval)
+                defer ticker.Stop()
+
+                for {
+                        select {
+                        case <-w.done:
+                                return
+                        case <-ticker.C:
+                        }
+
+                        after, err := pollTree(root, opts)
+                        if err != nil {
+                                select {
+                                case errs <- err:
+                                default:
+                                }
+                                continue
+                        }
+
+                        for _, event := range diffSnapshots(before, after) {
+                                select {
+                                case events <- event:
+                                case <-w.done:
+                                        return
+                                }
+                        }
+                        before = after
+                }
+        }()
+
+        return w, nil
+}
+
+// pollTree snapshots every watched path under root
+func pollTree(root string, opts WatchOptions) (map[string]pollSnapshot, error) {
+        snapshot := make(map[string]pollSnapshot)
+
+        err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+                if err != nil {
+                        // Entries can vanish mid-walk; they show up in the next poll
+                        if os.IsNotExist(err) {
+                                return nil
+                        }
+                        return err
+                }
+                if path == root {
+                        return nil
+                }
+                if skipWatchPath(root, path, opts) {
+                        if d.IsDir() {
+                                return filepath.SkipDir
+                        }
+                        return nil
+                }
+
+                info, err := d.Info()
+                if err != nil {
+                        return nil
+                }
+                snapshot[path] = pollSnapshot{size: info.Size(), modTime: info.ModTime(), isDir: d.IsDir()}
+
+                if d.IsDir() && !opts.Recursive {
+                        return filepath.SkipDir
+                }
+                return nil
+        })
+
+        return snapshot, err
+}
+
+// diffSnapshots turns the difference between two snapshots into events.
+// A deletion and creation of files with the same size and modification
+// time within one poll are reported as a rename.
+func diffSnapshots(before, after map[string]pollSnapshot) []models.WatchEvent {
+        now := time.Now()
+        var created, deleted, events []models.WatchEvent
+
+        for path, snap := range after {
+                old, existed := before[path]
+                switch {
+                case !existed:
+                        created = append(created, models.WatchEvent{Time: now, Op: EventCreate, Path: path, IsDir: snap.isDir})
+                case !snap.isDir && (old.size != snap.size || !old.modTime.Equal(snap.modTime)):
+                        events = append(events, models.WatchEvent{Time: now, Op: EventModify, Path: path})
+                }
+        }
+        for path, snap := range before {
+                if _, exists := after[path]; !exists {
+                        deleted = append(deleted, models.WatchEvent{Time: now, Op: EventDelete, Path: path, IsDir: snap.isDir})
+                }
+        }
+
+        for i := range created {
+                for j := range deleted {
+                        if deleted[j].Op != EventDelete || deleted[j].IsDir != created[i].IsDir {
+                                continue
+                        }
+                        if before[deleted[j].Path] == after[created[i].Path] {
+                                created[i].Op, created[i].OldPath = EventRename, deleted[j].Path
+                                deleted[j].Op = ""
+                                break
+                        }
+                }
+        }
+
+        for _, event := range deleted {
+                if event.Op != "" {
+                        events = append(events, event)
+                }
+        }
+        return append(events, created...)
+}
@@ -0,0 +1,246 @@
+//go:build linux
+
+package fileops
+
+import (
+        "io/fs"
+        "os"
+        "path/filepath"
+        "strings"
+        "sync"
+        "syscall"
+        "time"
+        "unsafe"
+
+        "github.com/user/filer/internal/models"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+        syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatcher tracks the watch descriptor of every watched directory
+type inotifyWatcher struct {
+        root  string
+        opts  WatchOptions
+        fd    int
+        file  *os.File
+        mu    sync.Mutex
+        paths map[int32]string
+}
+
+func newNativeWatcher(root string, opts WatchOptions) (*Watcher, error) {
+        fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+        if err != nil {
+                return nil, err
+        }
+
+        iw := &inotifyWatcher{
+                root:  filepath.Clean(root),
+                opts:  opts,
+                fd:    fd,
+                file:  os.NewFile(uintptr(fd), "inotify"),
+                paths: make(map[int32]string),
+        }
+
+        if err := iw.addTree(iw.root, nil); err != nil {
+                iw.file.Close()
+                return nil, err
+        }
+
+        events := make(chan models.WatchEvent, 256)
+        errs := make(chan error, 1)
+        w := &Watcher{
+                Events:  events,
+                Errors:  errs,
+                Backend: BackendNative,
+                done:    make(chan struct{}),
+                closeFn: iw.file.Close,
+        }
+
+        go iw.run(w, events, errs)
+        return w, nil
+}
+
+// addTree watches dir and, for recursive watchers, every directory below
+// it. Files found in directories that appeared after watching began are
+// reported through found, since their creation events were missed.
+func (iw *inotifyWatcher) addTree(dir string, found func(path string, isDir bool)) error {
+        return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+                if err != nil {
+                        if os.IsNotExist(err) {
+                                return nil
+                        }
+                        return err
+                }
+                if skipWatchPath(iw.root, path, iw.opts) {
+                        if d.IsDir() {
+                                return filepath.SkipDir
+                        }
+                        return nil
+                }
+
+                if path != dir && found != nil {
+                        found(path, d.IsDir())
+                }
+
+                if !d.IsDir() {
+                        return nil
+                }
+                if path != iw.root && !iw.opts.Recursive {
+                        return filepath.SkipDir
+                }
+
+                wd, err := syscall.InotifyAddWatch(iw.fd, path, inotifyMask)
+                if err != nil {
+                        return err
+                }
+                iw.mu.Lock()
+                iw.paths[int32(wd)] = path
+                iw.mu.Unlock()
+                return nil
+        })
+}
+
+// renameWatched updates watched directory paths after a directory moved
+func (iw *inotifyWatcher) renameWatched(oldPath, newPath string) {
+        iw.mu.Lock()
+        defer iw.mu.Unlock()
+
+        prefix := oldPath + string(filepath.Separator)
+        for wd, path := range iw.paths {
+                if path == oldPath {
+                        iw.paths[wd] = newPath
+                } else if strings.HasPrefix(path, prefix) {
+                        iw.paths[wd] = newPath + path[len(oldPath):]
+                }
+        }
+}
+
+func (iw *inotifyWatcher) run(w *Watcher, events chan<- models.WatchEvent, errs chan<- error) {
+        defer close(events)
+        defer close(errs)
+
+        buf := make([]byte, 64*1024)
+
+        for {
+                n, err := iw.file.Read(buf)
+                if err != nil {
+                        select {
+                        case <-w.done:
+                        default:
+                                errs <- err
+                        }
+                        return
+                }
+
+                batch, overflowed := iw.parse(buf[:n])
+                for _, event := range batch {
+                        select {
+                        case events <- event:
+                        case <-w.done:
+                                return
+                        }
+                }
+                if overflowed {
+                        select {
+                        case errs <- ErrEventsLost:
+                        case <-w.done:
+                                return
+                        }
+                }
+        }
+}
+
+// parse decodes a buffer of inotify events, pairing moves into renames and
+// collapsing repeated modifications of the same file. It also reports
+// whether the kernel's event queue overflowed, dropping events.
+func (iw *inotifyWatcher) parse(buf []byte) ([]models.WatchEvent, bool) {
+        now := time.Now()
+        var batch []models.WatchEvent
+        movedFrom := make(map[uint32]int)
+        lastModify := make(map[string]bool)
+        overflowed := false
+
+        emit := func(event models.WatchEvent) {
+                event.Time = now
+                batch = append(batch, event)
+        }
+
+        for offset := 0; offset+syscall.SizeofInotifyEvent <= len(buf); {
+                raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+                nameStart := offset + syscall.SizeofInotifyEvent
+                nameEnd := nameStart + int(raw.Len)
+                if nameEnd > len(buf) {
+                        break
+                }
+                name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+                offset = nameEnd
+
+                if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+                        overflowed = true
+                        continue
+                }
+
+                iw.mu.Lock()
+                dir, known := iw.paths[raw.Wd]
+                if raw.Mask&syscall.IN_IGNORED != 0 {
+                        delete(iw.paths, raw.Wd)
+                }
+                iw.mu.Unlock()
+                if !known || name == "" {
+                        continue
+                }
+
+                path := filepath.Join(dir, name)
+                isDir := raw.Mask&syscall.IN_ISDIR != 0
+                if skipWatchPath(iw.root, path, iw.opts) {
+                        continue
+                }
+
+                switch {
+                case raw.Mask&syscall.IN_CREATE != 0:
+                        emit(models.WatchEvent{Op: EventCreate, Path: path, IsDir: isDir})
+                        if isDir && iw.opts.Recursive {
+                                iw.addTree(path, func(found string, foundDir bool) {
+                                        emit(models.WatchEvent{Op: EventCreate, Path: found, IsDir: foundDir})
+                                })
+                        }
+
+                case raw.Mask&syscall.IN_MODIFY != 0:
+                        if lastModify[path] {
+                                continue
+                        }
+                        lastModify[path] = true
+                        emit(models.WatchEvent{Op: EventModify, Path: path})
+                        continue
+
+                case raw.Mask&syscall.IN_DELETE != 0:
+                        emit(models.WatchEvent{Op: EventDelete, Path: path, IsDir: isDir})
+
+                case raw.Mask&syscall.IN_MOVED_FROM != 0:
+                        movedFrom[raw.Cookie] = len(batch)
+                        emit(models.WatchEvent{Op: EventDelete, Path: path, IsDir: isDir})
+
+                case raw.Mask&syscall.IN_MOVED_TO != 0:
+                        if i, ok := movedFrom[raw.Cookie]; ok {
+                                batch[i].Op, batch[i].OldPath, batch[i].Path = EventRename, batch[i].Path, path
+                                delete(movedFrom, raw.Cookie)
+                                if isDir {
+                                        iw.renameWatched(batch[i].OldPath, path)
+                                }
+                        } else {
+                                emit(models.WatchEvent{Op: EventCreate, Path: path, IsDir: isDir})
+                                if isDir && iw.opts.Recursive {
+                                        iw.addTree(path, func(found string, foundDir bool) {
+                                                emit(models.WatchEvent{Op: EventCreate, Path: found, IsDir: foundDir})
+                                        })
+                                }
+                        }
+                }
+
+                // Any other event ends a run of modifications
+                delete(lastModify, path)
+        }
+
+        return batch, overflowed
+}
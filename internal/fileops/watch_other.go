@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fileops
+
+import "errors"
+
+var errNoNative = errors.New("native file watching is not supported on this platform")
+
+// newNativeWatcher is unavailable here, so watchers always poll
+func newNativeWatcher(root string, opts WatchOptions) (*Watcher, error) {
+        return nil, errNoNative
+}
@@ -0,0 +1,156 @@
+// Package mimetype detects the MIME type of files from their contents,
+// falling back to their extension when the contents are inconclusive.
+package mimetype
+
+import (
+        "io"
+        "mime"
+        "net/http"
+        "os"
+        "path"
+        "path/filepath"
+        "strings"
+
+        "github.com/user/filer/internal/models"
+)
+
+const (
+        // Directory is reported for directories
+        Directory = "inode/directory"
+
+        // Unknown is reported when neither contents nor extension tell the type
+        Unknown = "application/octet-stream"
+)
+
+// sniffLen is how much of a file content sniffing looks at
+const sniffLen = 512
+
+// zipContainers are extensions of formats stored as ZIP archives, which
+// sniff as application/zip
+var zipContainers = map[string]bool{
+        "docx": true, "xlsx": true, "pptx": true,
+        "odt": true, "ods": true, "odp": true,
+        "epub": true, "jar": true, "apk": true,
+}
+
+// FromExtension returns the MIME type implied by an extension (with or
+// without the leading dot), or Unknown
+func FromExtension(ext string) string {
+        if ext == "" {
+                return Unknown
+        }
+        mimeType := mime.TypeByExtension("." + strings.ToLower(strings.TrimPrefix(ext, ".")))
+        if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+                return mediaType
+        }
+        return Unknown
+}
+
+// Detect sniffs the MIME type of the file at path from its first bytes.
+// Contents that only sniff as generic binary or plain text defer to a more
+// specific type implied by the extension, so source files and the like are
+// still told apart.
+func Detect(filePath string) (string, error) {
+        f, err := os.Open(filePath)
+        if err != nil {
+                return "", err
+        }
+        defer f.Close()
+
+        buf := make([]byte, sniffLen)
+        n, err := io.ReadFull(f, buf)
+        if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+                return "", err
+        }
+
+        byExt := FromExtension(filepath.Ext(filePath))
+        if n == 0 {
+                return byExt, nil
+        }
+
+        sniffed, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+        if err != nil {
+                return byExt, nil
+        }
+
+        switch {
+        case sniffed == Unknown:
+                return byExt, nil
+        case sniffed == "text/plain" && isText(byExt):
+                return byExt, nil
+        }
+        return sniffed, nil
+}
+
+// Fill detects and records the MIME type of file unless it is already
+// known, and returns it. Files that cannot be read fall back to their
+// extension.
+func Fill(file *models.FileInfo) string {
+        if file.MimeType != "" {
+                return file.MimeType
+        }
+
+        switch {
+        case file.IsDir:
+                file.MimeType = Directory
+        case !strings.HasPrefix(file.Mode, "-"):
+                // Devices, sockets and the like are not read
+                file.MimeType = FromExtension(file.Extension)
+        default:
+                mimeType, err := Detect(file.Path)
+                if err != nil {
+                        mimeType = FromExtension(file.Extension)
+                }
+                file.MimeType = mimeType
+        }
+        return file.MimeType
+}
+
+// Match reports whether mimeType matches pattern, which may be a full type
+// (text/html), a wildcard (image/*) or just the top-level type (image)
+func Match(pattern, mimeType string) bool {
+        pattern = strings.ToLower(strings.TrimSpace(pattern))
+        mimeType = strings.ToLower(mimeType)
+        if !strings.Contains(pattern, "/") {
+                pattern += "/*"
+        }
+        matched, _ := path.Match(pattern, mimeType)
+        return matched
+}
+
+// Agrees reports whether detected contents are consistent with a file's
+// extension. Extensions or contents of unknown type never disagree, and
+// types sharing a subtype (audio/ogg, application/ogg) or a non-application
+// top-level type (image/bmp, image/x-ms-bmp) are considered equivalent.
+func Agrees(ext, detected string) bool {
+        ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+        byExt := FromExtension(ext)
+        if byExt == Unknown || detected == Unknown || byExt == detected {
+                return true
+        }
+        if detected == "application/zip" && zipContainers[ext] {
+                return true
+        }
+
+        extType, extSub, _ := strings.Cut(byExt, "/")
+        detType, detSub, _ := strings.Cut(detected, "/")
+        if extSub == detSub {
+                return true
+        }
+        return extType == detType && extType != "application"
+}
+
+// isText reports whether a MIME type denotes textual content
+func isText(mimeType string) bool {
+        switch {
+        case strings.HasPrefix(mimeType, "text/"):
+                return true
+        case strings.HasSuffix(mimeType, "+xml"), strings.HasSuffix(mimeType, "+json"):
+                return true
+        }
+        switch mimeType {
+        case "application/json", "application/xml", "application/javascript", "application/x-sh":
+                return true
+        }
+        return false
+}
@@ -19,6 +19,16 @@ type FileInfo struct {
         Extension  string    `json:"extension"`
         MimeType   string    `json:"mime_type,omitempty"`
         Hidden     bool      `json:"hidden"`
+        MatchCount int            `json:"match_count,omitempty"`
+        Matches    []ContentMatch `json:"matches,omitempty"`
+}
+
+// ContentMatch represents a matching line found by a content search
+type ContentMatch struct {
+        Line   int      `json:"line"`
+        Text   string   `json:"text"`
+        Before []string `json:"before,omitempty"`
+        After  []string `json:"after,omitempty"`
 }
 
 // DirectoryStats represents directory statistics
@@ -28,16 +38,197 @@ type DirectoryStats struct {
         TotalDirs      int               `json:"total_dirs"`
         TotalSize      int64             `json:"total_size"`
         TotalSizeHuman string            `json:"total_size_human"`
-        FileTypes      map[string]int    `json:"file_types"`
+        FileTypes      map[string]*TypeStats `json:"file_types"`
         LargestFile    *FileInfo         `json:"largest_file,omitempty"`
         OldestFile     *FileInfo         `json:"oldest_file,omitempty"`
         NewestFile     *FileInfo         `json:"newest_file,omitempty"`
-        Extensions     map[string]int    `json:"extensions"`
+        Extensions     map[string]*ExtensionStats `json:"extensions"`
+        LargestFiles   []*FileInfo       `json:"largest_files,omitempty"`
+        LargestDirs    []*DirSize        `json:"largest_dirs,omitempty"`
+        SizeHistogram  []HistogramBucket `json:"size_histogram"`
+        AgeHistogram   []HistogramBucket `json:"age_histogram"`
+}
+
+// HistogramBucket counts the files falling into one range of a histogram
+type HistogramBucket struct {
+        Label string `json:"label"`
+        Count int    `json:"count"`
+        Size  int64  `json:"size"`
+}
+
+// StatsOptions controls the optional parts of directory statistics
+type StatsOptions struct {
+        TopFiles int
+        TopDirs  int
+}
+
+// DirSize is the recursive size of a directory, as reported by du
+type DirSize struct {
+        Path      string `json:"path"`
+        Files     int    `json:"files"`
+        Size      int64  `json:"size"`
+        SizeHuman string `json:"size_human"`
+}
+
+// TypeStats summarizes the files of one category within a directory
+type TypeStats struct {
+        Count     int    `json:"count"`
+        Size      int64  `json:"size"`
+        SizeHuman string `json:"size_human"`
+}
+
+// ExtensionStats summarizes the files with one extension within a directory
+type ExtensionStats struct {
+        Count        int    `json:"count"`
+        Size         int64  `json:"size"`
+        SizeHuman    string `json:"size_human"`
+        AverageSize  int64  `json:"average_size"`
+        AverageHuman string `json:"average_human"`
+        LargestFile  string `json:"largest_file"`
+        LargestSize  int64  `json:"largest_size"`
+}
+
+// TreeNode represents a file or directory within a hierarchical listing
+type TreeNode struct {
+        Info      *FileInfo   `json:"info"`
+        Children  []*TreeNode `json:"children,omitempty"`
+        ItemCount int         `json:"item_count"`
+        TotalSize int64       `json:"total_size"`
+}
+
+// DuplicateSet represents a group of files with identical contents
+type DuplicateSet struct {
+        Hash        string      `json:"hash"`
+        Size        int64       `json:"size"`
+        SizeHuman   string      `json:"size_human"`
+        Files       []*FileInfo `json:"files"`
+        WastedBytes int64       `json:"wasted_bytes"`
+        WastedHuman string      `json:"wasted_human"`
+}
+
+// DedupeOptions controls how duplicate sets are resolved
+type DedupeOptions struct {
+        Action      string
+        Keep        string
+        Priority    []string
+        DryRun      bool
+        JournalPath string
+}
+
+// DedupeResult describes what happened (or would happen) to one duplicate
+type DedupeResult struct {
+        Action string `json:"action"`
+        Path   string `json:"path"`
+        Keeper string `json:"keeper"`
+        Size   int64  `json:"size"`
+        Reason string `json:"reason,omitempty"`
+}
+
+// JournalEntry records a single filesystem change made by filer
+type JournalEntry struct {
+        Run     string     `json:"run"`
+        Time    time.Time  `json:"time"`
+        Op      string     `json:"op"`
+        Path    string     `json:"path"`
+        Target  string     `json:"target,omitempty"`
+        Size    int64      `json:"size,omitempty"`
+        ModTime *time.Time `json:"mod_time,omitempty"`
+        Hash    string     `json:"hash,omitempty"`
+}
+
+// OrganizeOptions controls how files are organized
+type OrganizeOptions struct {
+        DryRun    bool
+        Conflict  string
+        Rules     []OrganizeRule
+        Layout    string
+        Template  string
+        Recursive bool
+        MaxDepth  int
+        Flatten   bool
+        Paths     []string
+        Sniff     bool
+        Run       string // journal run to record into; empty starts a new one
+}
+
+// OrganizeRule maps files matching all of its criteria to a destination.
+// Rules are tried in order and the first match wins.
+type OrganizeRule struct {
+        Name       string   `json:"name"`
+        Extensions []string `json:"extensions,omitempty"`
+        Glob       string   `json:"glob,omitempty"`
+        Regex      string   `json:"regex,omitempty"`
+        MinSize    string   `json:"min_size,omitempty"`
+        MaxSize    string   `json:"max_size,omitempty"`
+        OlderThan  string   `json:"older_than,omitempty"`
+        NewerThan  string   `json:"newer_than,omitempty"`
+        MimeType   string   `json:"mime_type,omitempty"`
+        Dest       string   `json:"dest,omitempty"`
+}
+
+// RulesConfig is the contents of an organize rules file
+type RulesConfig struct {
+        Rules []OrganizeRule `json:"rules"`
+}
+
+// RuleIssue describes a problem found when validating organize rules
+type RuleIssue struct {
+        Rule    int    `json:"rule"`
+        Name    string `json:"name"`
+        Kind    string `json:"kind"`
+        Message string `json:"message"`
+}
+
+// RulesValidation is the result of validating a set of organize rules
+type RulesValidation struct {
+        Source string         `json:"source"`
+        Rules  []OrganizeRule `json:"rules"`
+        Issues []RuleIssue    `json:"issues"`
+}
+
+// OrganizeEntry describes what happened (or would happen) to one file
+// during organize
+type OrganizeEntry struct {
+        Name     string `json:"name"`
+        Source   string `json:"source"`
+        Target   string `json:"target"`
+        Category string `json:"category"`
+        Dest     string `json:"dest"`
+        Action   string `json:"action"`
+        Reason   string `json:"reason,omitempty"`
+        MimeType string `json:"mime_type,omitempty"`
+        Mismatch bool   `json:"mismatch,omitempty"`
+        Backup   string `json:"backup,omitempty"`
+}
+
+// WatchEvent represents a change observed in a watched directory tree
+type WatchEvent struct {
+        Time    time.Time `json:"time"`
+        Op      string    `json:"op"`
+        Path    string    `json:"path"`
+        OldPath string    `json:"old_path,omitempty"`
+        IsDir   bool      `json:"is_dir"`
+}
+
+// UndoOptions controls how a journaled organize run is reversed
+type UndoOptions struct {
+        DryRun bool
+        Force  bool
+}
+
+// UndoResult describes what happened (or would happen) to one journal entry
+type UndoResult struct {
+        Action string `json:"action"`
+        Path   string `json:"path"`
+        From   string `json:"from,omitempty"`
+        Reason string `json:"reason,omitempty"`
 }
 
 // SearchOptions represents search criteria
 type SearchOptions struct {
         Pattern    string
+        PatternMode   string
+        CaseSensitive bool
         Extension  string
         MinSize    int64
         MaxSize    int64
@@ -45,6 +236,12 @@ type SearchOptions struct {
         ModifiedBefore time.Time
         IncludeHidden bool
         Recursive     bool
+        ContentPattern    string
+        ContentRegex      bool
+        ContentIgnoreCase bool
+        ContextLines      int
+        MimeType          string
+        Filter            func(*FileInfo) bool
 }
 
 // NewFileInfo creates a FileInfo from os.FileInfo
@@ -0,0 +1,78 @@
+package query
+
+import (
+        "sort"
+        "strings"
+
+        "github.com/user/filer/internal/mimetype"
+        "github.com/user/filer/internal/models"
+)
+
+type fieldKind int
+
+const (
+        kindString fieldKind = iota
+        kindSize
+        kindTime
+        kindAge
+        kindBool
+)
+
+// field describes an attribute of a file that expressions can refer to
+type field struct {
+        name    string
+        kind    fieldKind
+        fold    bool
+        str     func(file *models.FileInfo) string
+        boolean func(file *models.FileInfo) bool
+}
+
+// normalize prepares a string value for comparison
+func (f field) normalize(s string) string {
+        if f.fold {
+                return strings.ToLower(strings.TrimPrefix(s, "."))
+        }
+        return s
+}
+
+var fields = map[string]field{
+        "name": {name: "name", kind: kindString, str: func(file *models.FileInfo) string { return file.Name }},
+        "path": {name: "path", kind: kindString, str: func(file *models.FileInfo) string { return file.Path }},
+        "ext":  {name: "ext", kind: kindString, fold: true, str: func(file *models.FileInfo) string { return file.Extension }},
+        "type": {name: "type", kind: kindString, fold: true, str: func(file *models.FileInfo) string {
+                if file.IsDir {
+                        return "dir"
+                }
+                return "file"
+        }},
+        // The MIME type is sniffed from the file's contents on first use
+        "mime":     {name: "mime", kind: kindString, fold: true, str: mimetype.Fill},
+        "size":     {name: "size", kind: kindSize},
+        "modified": {name: "modified", kind: kindTime},
+        "age":      {name: "age", kind: kindAge},
+        "hidden":   {name: "hidden", kind: kindBool, boolean: func(file *models.FileInfo) bool { return file.Hidden }},
+}
+
+var fieldAliases = map[string]string{
+        "extension": "ext",
+        "mtime":     "modified",
+        "mimetype":  "mime",
+}
+
+func lookupField(name string) (field, bool) {
+        name = strings.ToLower(name)
+        if alias, ok := fieldAliases[name]; ok {
+                name = alias
+        }
+        f, ok := fields[name]
+        return f, ok
+}
+
+func fieldNames() string {
+        names := make([]string, 0, len(fields))
+        for name := range fields {
+                names = append(names, name)
+        }
+        sort.Strings(names)
+        return strings.Join(names, ", ")
+}
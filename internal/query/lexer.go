@@ -0,0 +1,111 @@
+package query
+
+import (
+        "fmt"
+        "strings"
+)
+
+type tokenKind int
+
+const (
+        tokEOF tokenKind = iota
+        tokWord
+        tokString
+        tokOp
+        tokLParen
+        tokRParen
+        tokComma
+)
+
+// token is a lexical element of a filter expression
+type token struct {
+        kind tokenKind
+        text string
+        pos  int
+}
+
+// describe renders a token for use in error messages
+func (t token) describe() string {
+        if t.kind == tokEOF {
+                return "end of expression"
+        }
+        return fmt.Sprintf("%q", t.text)
+}
+
+// isKeyword reports whether the token is the given (case-insensitive) keyword
+func (t token) isKeyword(keyword string) bool {
+        return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+// operators lists the comparison operators, longest first
+var operators = []string{"==", "!=", "<=", ">=", "!~", "=", "<", ">", "~"}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+        var tokens []token
+        i := 0
+
+        for i < len(src) {
+                c := src[i]
+                switch {
+                case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+                        i++
+
+                case c == '(':
+                        tokens = append(tokens, token{tokLParen, "(", i})
+                        i++
+
+                case c == ')':
+                        tokens = append(tokens, token{tokRParen, ")", i})
+                        i++
+
+                case c == ',':
+                        tokens = append(tokens, token{tokComma, ",", i})
+                        i++
+
+                case c == '"' || c == '\'':
+                        start := i
+                        var sb strings.Builder
+                        i++
+                        for {
+                                if i >= len(src) {
+                                        return nil, newError(src, start, "unterminated string")
+                                }
+                                if src[i] == c {
+                                        i++
+                                        break
+                                }
+                                if src[i] == '\\' && i+1 < len(src) {
+                                        i++
+                                }
+                                sb.WriteByte(src[i])
+                                i++
+                        }
+                        tokens = append(tokens, token{tokString, sb.String(), start})
+
+                case strings.IndexByte("=!<>~", c) >= 0:
+                        op := ""
+                        for _, candidate := range operators {
+                                if strings.HasPrefix(src[i:], candidate) {
+                                        op = candidate
+                                        break
+                                }
+                        }
+                        if op == "" {
+                                return nil, newError(src, i, fmt.Sprintf("unexpected character %q", c))
+                        }
+                        tokens = append(tokens, token{tokOp, op, i})
+                        i += len(op)
+
+                default:
+                        start := i
+                        for i < len(src) && !strings.ContainsRune(" \t\n\r(),\"'=!<>~", rune(src[i])) {
+                                i++
+                        }
+                        tokens = append(tokens, token{tokWord, src[start:i], start})
+                }
+        }
+
+        tokens = append(tokens, token{tokEOF, "", len(src)})
+        return tokens, nil
+}
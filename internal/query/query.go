@@ -0,0 +1,349 @@
+// Package query implements the filter expression language used by the
+// --where flag, for example:
+//
+//	ext in (go,md) and (size > 10MiB or age < 7d) and not name ~ "_test"
+//
+// Expressions combine comparisons with and, or, not and parentheses.
+// Comparisons take the form "field op value" or "field in (v1, v2, ...)".
+// Times compare points in time, so "modified < 7d" selects files last
+// changed more than a week ago; ages compare how long ago, so "age < 7d"
+// selects files changed within the last week.
+package query
+
+import (
+        "fmt"
+        "regexp"
+        "strconv"
+        "strings"
+        "time"
+
+        "github.com/user/filer/internal/models"
+        "github.com/user/filer/internal/units"
+)
+
+// Predicate reports whether a file satisfies a compiled expression
+type Predicate func(file *models.FileInfo) bool
+
+// Error describes a syntax or type error in an expression,
+// pointing at the offending token
+type Error struct {
+        Query string
+        Pos   int
+        Msg   string
+}
+
+func (e *Error) Error() string {
+        return fmt.Sprintf("%s at position %d\n  %s\n  %s^",
+                e.Msg, e.Pos+1, e.Query, strings.Repeat(" ", e.Pos))
+}
+
+func newError(src string, pos int, msg string) *Error {
+        return &Error{Query: src, Pos: pos, Msg: msg}
+}
+
+// Compile parses an expression into a predicate over files.
+// Relative ages such as "7d" are measured from the time of compilation.
+func Compile(src string) (Predicate, error) {
+        tokens, err := lex(src)
+        if err != nil {
+                return nil, err
+        }
+
+        p := &parser{src: src, tokens: tokens, now: time.Now()}
+        if p.peek().kind == tokEOF {
+                return nil, p.errorf(p.peek(), "empty expression")
+        }
+
+        pred, err := p.parseOr()
+        if err != nil {
+                return nil, err
+        }
+        if tok := p.peek(); tok.kind != tokEOF {
+                return nil, p.errorf(tok, "unexpected %s, expected \"and\", \"or\" or end of expression", tok.describe())
+        }
+
+        return pred, nil
+}
+
+type parser struct {
+        src    string
+        tokens []token
+        pos    int
+        now    time.Time
+}
+
+func (p *parser) peek() token {
+        return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+        tok := p.tokens[p.pos]
+        if tok.kind != tokEOF {
+                p.pos++
+        }
+        return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+        return newError(p.src, tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (Predicate, error) {
+        left, err := p.parseAnd()
+        if err != nil {
+                return nil, err
+        }
+
+        for p.peek().isKeyword("or") {
+                p.next()
+                right, err := p.parseAnd()
+                if err != nil {
+                        return nil, err
+                }
+                l, r := left, right
+                left = func(file *models.FileInfo) bool { return l(file) || r(file) }
+        }
+
+        return left, nil
+}
+
+func (p *parser) parseAnd() (Predicate, error) {
+        left, err := p.parseNot()
+        if err != nil {
+                return nil, err
+        }
+
+        for p.peek().isKeyword("and") {
+                p.next()
+                right, err := p.parseNot()
+                if err != nil {
+                        return nil, err
+                }
+                l, r := left, right
+                left = func(file *models.FileInfo) bool { return l(file) && r(file) }
+        }
+
+        return left, nil
+}
+
+func (p *parser) parseNot() (Predicate, error) {
+        if p.peek().isKeyword("not") {
+                p.next()
+                inner, err := p.parseNot()
+                if err != nil {
+                        return nil, err
+                }
+                return func(file *models.FileInfo) bool { return !inner(file) }, nil
+        }
+
+        return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Predicate, error) {
+        tok := p.peek()
+
+        switch {
+        case tok.kind == tokLParen:
+                p.next()
+                inner, err := p.parseOr()
+                if err != nil {
+                        return nil, err
+                }
+                if closing := p.next(); closing.kind != tokRParen {
+                        return nil, p.errorf(closing, "unexpected %s, expected \")\"", closing.describe())
+                }
+                return inner, nil
+
+        case tok.kind == tokWord && !isReserved(tok.text):
+                return p.parseComparison()
+        }
+
+        return nil, p.errorf(tok, "unexpected %s, expected a field name or \"(\"", tok.describe())
+}
+
+func isReserved(word string) bool {
+        switch strings.ToLower(word) {
+        case "and", "or", "not", "in":
+                return true
+        }
+        return false
+}
+
+func (p *parser) parseComparison() (Predicate, error) {
+        fieldTok := p.next()
+        f, ok := lookupField(fieldTok.text)
+        if !ok {
+                return nil, p.errorf(fieldTok, "unknown field %q (expected one of: %s)", fieldTok.text, fieldNames())
+        }
+
+        opTok := p.peek()
+
+        // Boolean fields may stand alone, e.g. "not hidden"
+        if f.kind == kindBool && opTok.kind != tokOp {
+                return func(file *models.FileInfo) bool { return f.boolean(file) }, nil
+        }
+
+        if opTok.isKeyword("in") {
+                p.next()
+                values, err := p.parseList()
+                if err != nil {
+                        return nil, err
+                }
+                return p.compileIn(f, opTok, values)
+        }
+
+        if opTok.kind != tokOp {
+                return nil, p.errorf(opTok, "unexpected %s, expected an operator after %q", opTok.describe(), fieldTok.text)
+        }
+        p.next()
+
+        valueTok := p.next()
+        if valueTok.kind != tokWord && valueTok.kind != tokString {
+                return nil, p.errorf(valueTok, "unexpected %s, expected a value", valueTok.describe())
+        }
+
+        return p.compileComparison(f, opTok, valueTok)
+}
+
+// parseList parses a parenthesized, comma-separated list of values
+func (p *parser) parseList() ([]token, error) {
+        if open := p.next(); open.kind != tokLParen {
+                return nil, p.errorf(open, "unexpected %s, expected \"(\" after \"in\"", open.describe())
+        }
+
+        var values []token
+        for {
+                tok := p.next()
+                if tok.kind != tokWord && tok.kind != tokString {
+                        return nil, p.errorf(tok, "unexpected %s, expected a value", tok.describe())
+                }
+                values = append(values, tok)
+
+                sep := p.next()
+                if sep.kind == tokRParen {
+                        return values, nil
+                }
+                if sep.kind != tokComma {
+                        return nil, p.errorf(sep, "unexpected %s, expected \",\" or \")\"", sep.describe())
+                }
+        }
+}
+
+func (p *parser) compileIn(f field, opTok token, values []token) (Predicate, error) {
+        if f.kind != kindString {
+                return nil, p.errorf(opTok, "operator \"in\" is not supported for field %q", f.name)
+        }
+
+        set := make(map[string]bool, len(values))
+        for _, v := range values {
+                set[f.normalize(v.text)] = true
+        }
+
+        return func(file *models.FileInfo) bool {
+                return set[f.normalize(f.str(file))]
+        }, nil
+}
+
+func (p *parser) compileComparison(f field, opTok, valueTok token) (Predicate, error) {
+        op := opTok.text
+        if op == "==" {
+                op = "="
+        }
+
+        unsupported := func() error {
+                return p.errorf(opTok, "operator %q is not supported for field %q", opTok.text, f.name)
+        }
+
+        switch f.kind {
+        case kindString:
+                switch op {
+                case "=", "!=":
+                        want := f.normalize(valueTok.text)
+                        negate := op == "!="
+                        return func(file *models.FileInfo) bool {
+                                return (f.normalize(f.str(file)) == want) != negate
+                        }, nil
+                case "~", "!~":
+                        re, err := regexp.Compile(valueTok.text)
+                        if err != nil {
+                                return nil, p.errorf(valueTok, "invalid regular expression: %v", err)
+                        }
+                        negate := op == "!~"
+                        return func(file *models.FileInfo) bool {
+                                return re.MatchString(f.str(file)) != negate
+                        }, nil
+                }
+                return nil, unsupported()
+
+        case kindSize:
+                if op == "~" || op == "!~" {
+                        return nil, unsupported()
+                }
+                want, err := units.ParseSize(valueTok.text)
+                if err != nil {
+                        return nil, p.errorf(valueTok, "%v", err)
+                }
+                return func(file *models.FileInfo) bool {
+                        return compare(op, file.Size, want)
+                }, nil
+
+        case kindTime:
+                if op == "~" || op == "!~" {
+                        return nil, unsupported()
+                }
+                when, err := units.ParseTime(valueTok.text, p.now)
+                if err != nil {
+                        return nil, p.errorf(valueTok, "%v", err)
+                }
+                return func(file *models.FileInfo) bool {
+                        return compare(op, file.ModTime.UnixNano(), when.UnixNano())
+                }, nil
+
+        case kindAge:
+                if op == "~" || op == "!~" {
+                        return nil, unsupported()
+                }
+                age, err := units.ParseDuration(valueTok.text)
+                if err != nil {
+                        return nil, p.errorf(valueTok, "%v", err)
+                }
+                now := p.now
+                return func(file *models.FileInfo) bool {
+                        return compare(op, int64(now.Sub(file.ModTime)), int64(age))
+                }, nil
+
+        case kindBool:
+                if op != "=" && op != "!=" {
+                        return nil, unsupported()
+                }
+                want, err := strconv.ParseBool(valueTok.text)
+                if err != nil {
+                        return nil, p.errorf(valueTok, "invalid boolean %q (expected true or false)", valueTok.text)
+                }
+                negate := op == "!="
+                return func(file *models.FileInfo) bool {
+                        return (f.boolean(file) == want) != negate
+                }, nil
+        }
+
+        return nil, unsupported()
+}
+
+// compare applies a comparison operator to two integers
+func compare(op string, a, b int64) bool {
+        switch op {
+        case "=":
+                return a == b
+        case "!=":
+                return a != b
+        case "<":
+                return a < b
+        case "<=":
+                return a <= b
+        case ">":
+                return a > b
+        case ">=":
+                return a >= b
+        }
+        return false
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+        "errors"
+        "reflect"
+        "strings"
+        "testing"
+        "time"
+
+        "github.com/user/filer/internal/models"
+)
+
+// testFiles returns fixtures whose MIME types are already set, so no
+// expression reads from disk
+func testFiles(now time.Time) []*models.FileInfo {
+        return []*models.FileInfo{
+                {Name: "main.go", Path: "src/main.go", Extension: "go", Size: 2048, ModTime: now.Add(-24 * time.Hour), Mode: "-rw-r--r--", MimeType: "text/x-go"},
+                {Name: "README.md", Path: "README.md", Extension: "md", Size: 20 << 20, ModTime: now.Add(-30 * day), Mode: "-rw-r--r--", MimeType: "text/markdown"},
+                {Name: ".env", Path: ".env", Extension: "env", Size: 10, ModTime: now.Add(-time.Hour), Mode: "-rw-------", MimeType: "text/plain", Hidden: true},
+                {Name: "src", Path: "src", Size: 4096, ModTime: now.Add(-100 * day), Mode: "drwxr-xr-x", MimeType: "inode/directory", IsDir: true},
+        }
+}
+
+const day = 24 * time.Hour
+
+func TestCompile(t *testing.T) {
+        tests := []struct {
+                expr string
+                want []string
+        }{
+                {`ext = go`, []string{"main.go"}},
+                {`ext == .GO`, []string{"main.go"}},
+                {`ext != go and type = file`, []string{"README.md", ".env"}},
+                {`extension = md`, []string{"README.md"}},
+                {`EXT = md OR Ext = go`, []string{"main.go", "README.md"}},
+
+                // in lists
+                {`ext in (go, md)`, []string{"main.go", "README.md"}},
+                {`ext in (GO)`, []string{"main.go"}},
+                {`ext in ("go", 'md', env)`, []string{"main.go", "README.md", ".env"}},
+                {`not ext in (go,md)`, []string{".env", "src"}},
+
+                // quoting
+                {`name = "main.go"`, []string{"main.go"}},
+                {`name = 'README.md'`, []string{"README.md"}},
+                {`path = "src/main.go"`, []string{"main.go"}},
+                {`name ~ '[.]md$'`, []string{"README.md"}},
+                {`name !~ "^[.]"`, []string{"main.go", "README.md", "src"}},
+                {`name = "a\"b"`, nil},
+
+                // precedence: not binds tighter than and, and tighter than or
+                {`ext = go or ext = md and size < 1k`, []string{"main.go"}},
+                {`(ext = go or ext = md) and size < 1k`, nil},
+                {`ext = md and size < 1k or hidden`, []string{".env"}},
+                {`ext = md and (size < 1k or hidden)`, nil},
+                {`not hidden and type = file`, []string{"main.go", "README.md"}},
+                {`not (hidden or type = dir)`, []string{"main.go", "README.md"}},
+                {`not not hidden`, []string{".env"}},
+
+                // booleans
+                {`hidden`, []string{".env"}},
+                {`hidden = true`, []string{".env"}},
+                {`hidden != true`, []string{"main.go", "README.md", "src"}},
+
+                // sizes
+                {`size = 2k`, []string{"main.go"}},
+                {`size > 2k`, []string{"README.md", "src"}},
+                {`size >= 20MiB`, []string{"README.md"}},
+                {`size > 20MB`, []string{"README.md"}},
+                {`size <= 10`, []string{".env"}},
+
+                // times compare modification times with a point in time
+                {`modified < 7d`, []string{"README.md", "src"}},
+                {`modified < "7d ago"`, []string{"README.md", "src"}},
+                {`mtime > 2w`, []string{"main.go", ".env"}},
+                {`modified <= 3mo`, []string{"src"}},
+                {`modified > yesterday`, []string{"main.go", ".env"}},
+                {`modified < 2000-01-01`, nil},
+
+                // ages compare how long ago files were modified
+                {`age < 7d`, []string{"main.go", ".env"}},
+                {`age > 2w`, []string{"README.md", "src"}},
+                {`age >= 3mo`, []string{"src"}},
+
+                // MIME types
+                {`mime = TEXT/Markdown`, []string{"README.md"}},
+                {`mime ~ "^text/"`, []string{"main.go", "README.md", ".env"}},
+        }
+
+        for _, tt := range tests {
+                pred, err := Compile(tt.expr)
+                if err != nil {
+                        t.Errorf("Compile(%q): unexpected error: %v", tt.expr, err)
+                        continue
+                }
+
+                var got []string
+                for _, file := range testFiles(time.Now()) {
+                        if pred(file) {
+                                got = append(got, file.Name)
+                        }
+                }
+                if !reflect.DeepEqual(got, tt.want) {
+                        t.Errorf("Compile(%q) matched %q, want %q", tt.expr, got, tt.want)
+                }
+        }
+}
+
+func TestCompileErrors(t *testing.T) {
+        tests := []struct {
+                expr string
+                pos  int
+                msg  string
+        }{
+                {``, 0, "empty expression"},
+                {`   `, 3, "empty expression"},
+                {`colour = red`, 0, "unknown field"},
+                {`size >`, 6, "expected a value"},
+                {`size 10`, 5, "expected an operator"},
+                {`ext = go and`, 12, "expected a field name"},
+                {`ext = go or or`, 12, "expected a field name"},
+                {`ext = go name = x`, 9, `unexpected "name"`},
+                {`(ext = go`, 9, `expected ")"`},
+                {`ext = go)`, 8, `unexpected ")"`},
+                {`ext in go`, 7, `expected "(" after "in"`},
+                {`ext in (go md)`, 11, `expected "," or ")"`},
+                {`ext in (go,)`, 11, "expected a value"},
+                {`ext in (go`, 10, `expected "," or ")"`},
+                {`size in (1k, 2k)`, 5, `operator "in" is not supported`},
+                {`size ~ 1k`, 5, `operator "~" is not supported`},
+                {`ext < go`, 4, `operator "<" is not supported`},
+                {`hidden > true`, 7, `operator ">" is not supported`},
+                {`size > 10XB`, 7, "invalid size"},
+                {`modified > someday`, 11, "invalid time"},
+                {`age > yesterday`, 6, "invalid duration"},
+                {`age ~ 1d`, 4, `operator "~" is not supported`},
+                {`hidden = maybe`, 9, "invalid boolean"},
+                {`name ~ "("`, 7, "invalid regular expression"},
+                {`name = "abc`, 7, "unterminated string"},
+                {`name = 'abc"`, 7, "unterminated string"},
+                {`ext ! go`, 4, "unexpected character"},
+                {`and = 1`, 0, "expected a field name"},
+        }
+
+        for _, tt := range tests {
+                _, err := Compile(tt.expr)
+                var qerr *Error
+                if !errors.As(err, &qerr) {
+                        t.Errorf("Compile(%q): got error %v, want a *query.Error", tt.expr, err)
+                        continue
+                }
+                if qerr.Pos != tt.pos || !strings.Contains(qerr.Msg, tt.msg) {
+                        t.Errorf("Compile(%q): got %q at %d, want %q at %d", tt.expr, qerr.Msg, qerr.Pos, tt.msg, tt.pos)
+                }
+        }
+}
+
+func TestErrorPointsAtToken(t *testing.T) {
+        _, err := Compile(`size > 10XB`)
+        if err == nil {
+                t.Fatal("expected an error")
+        }
+
+        want := "at position 8\n  size > 10XB\n         ^"
+        if !strings.HasSuffix(err.Error(), want) {
+                t.Errorf("got %q, want suffix %q", err.Error(), want)
+        }
+}
@@ -0,0 +1,53 @@
+// Package units parses the human-friendly sizes, durations and times
+// accepted by filer's command-line flags and filter expressions.
+package units
+
+import (
+        "fmt"
+        "math"
+        "strconv"
+        "strings"
+)
+
+// sizeUnits maps size suffixes to their multipliers. Two- and three-letter
+// suffixes follow SI (kB = 1000) and IEC (KiB = 1024) respectively, while
+// bare single letters are binary, as with du and find.
+var sizeUnits = map[string]float64{
+        "": 1, "b": 1,
+        "k": 1 << 10, "kb": 1e3, "kib": 1 << 10,
+        "m": 1 << 20, "mb": 1e6, "mib": 1 << 20,
+        "g": 1 << 30, "gb": 1e9, "gib": 1 << 30,
+        "t": 1 << 40, "tb": 1e12, "tib": 1 << 40,
+        "p": 1 << 50, "pb": 1e15, "pib": 1 << 50,
+}
+
+// ParseSize parses a size such as 512, 10MB, 1.5GiB or 512k into bytes
+func ParseSize(s string) (int64, error) {
+        num, unit := splitNumber(strings.TrimSpace(s))
+        multiplier, ok := sizeUnits[strings.ToLower(unit)]
+        if num == "" || !ok {
+                return 0, fmt.Errorf("invalid size %q (expected e.g. 512, 10MB, 1.5GiB or 512k)", s)
+        }
+
+        value, err := strconv.ParseFloat(num, 64)
+        if err != nil {
+                return 0, fmt.Errorf("invalid size %q (expected e.g. 512, 10MB, 1.5GiB or 512k)", s)
+        }
+
+        // float64(math.MaxInt64) rounds up to 2^63, which is already too big
+        bytes := value * multiplier
+        if bytes >= math.MaxInt64 {
+                return 0, fmt.Errorf("size %q is too large", s)
+        }
+
+        return int64(bytes), nil
+}
+
+// splitNumber splits a leading decimal number from its unit suffix
+func splitNumber(s string) (string, string) {
+        i := 0
+        for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+                i++
+        }
+        return s[:i], strings.TrimSpace(s[i:])
+}
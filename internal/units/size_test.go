@@ -0,0 +1,63 @@
+package units
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+        tests := []struct {
+                in   string
+                want int64
+        }{
+                {"0", 0},
+                {"512", 512},
+                {"100b", 100},
+                {"100B", 100},
+                {" 42 ", 42},
+
+                // Single letters are binary
+                {"512k", 512 << 10},
+                {"512K", 512 << 10},
+                {"7m", 7 << 20},
+                {"7 M", 7 << 20},
+                {"2g", 2 << 30},
+                {"2t", 2 << 40},
+                {"1p", 1 << 50},
+
+                // SI
+                {"1kB", 1000},
+                {"10MB", 10e6},
+                {"10mb", 10e6},
+                {"3GB", 3e9},
+                {"2TB", 2e12},
+                {"1pb", 1e15},
+
+                // IEC
+                {"1KiB", 1024},
+                {"10MiB", 10 << 20},
+                {"1.5GiB", 3 << 29},
+                {"1tib", 1 << 40},
+                {"1PiB", 1 << 50},
+
+                {"1.5k", 1536},
+                {".5m", 1 << 19},
+                {"8191P", 8191 << 50},
+        }
+
+        for _, tt := range tests {
+                got, err := ParseSize(tt.in)
+                if err != nil {
+                        t.Errorf("ParseSize(%q): unexpected error: %v", tt.in, err)
+                        continue
+                }
+                if got != tt.want {
+                        t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+                }
+        }
+}
+
+func TestParseSizeErrors(t *testing.T) {
+        for _, in := range []string{"", "MB", "10XB", "10 kibs", "1.2.3k", "-5", "5e3", "k10", "8EiB", "8192P", "99999999999999999999PB", "9223372036854775808"} {
+                if got, err := ParseSize(in); err == nil {
+                        t.Errorf("ParseSize(%q) = %d, want an error", in, got)
+                }
+        }
+}
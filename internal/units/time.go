@@ -0,0 +1,101 @@
+package units
+
+import (
+        "fmt"
+        "strconv"
+        "strings"
+        "time"
+)
+
+const day = 24 * time.Hour
+
+// durationUnits maps duration suffixes to their lengths. Months and years
+// are approximated as 30 and 365 days.
+var durationUnits = map[string]time.Duration{
+        "s":  time.Second,
+        "m":  time.Minute,
+        "h":  time.Hour,
+        "d":  day,
+        "w":  7 * day,
+        "mo": 30 * day,
+        "y":  365 * day,
+}
+
+// ParseDuration parses a relative duration such as 90s, 7d, 2w, 6mo, 1y
+// or a combination like 1d12h
+func ParseDuration(s string) (time.Duration, error) {
+        rest := strings.ToLower(strings.TrimSpace(s))
+        if rest == "" {
+                return 0, fmt.Errorf("invalid duration %q", s)
+        }
+
+        var total time.Duration
+        for rest != "" {
+                num, tail := splitNumber(rest)
+                unitLen := 0
+                for unitLen < len(tail) && tail[unitLen] >= 'a' && tail[unitLen] <= 'z' {
+                        unitLen++
+                }
+
+                unit, ok := durationUnits[tail[:unitLen]]
+                value, err := strconv.ParseFloat(num, 64)
+                if num == "" || !ok || err != nil {
+                        return 0, fmt.Errorf("invalid duration %q (expected e.g. 30m, 7d, 2w or 1y)", s)
+                }
+
+                total += time.Duration(value * float64(unit))
+                rest = strings.TrimSpace(tail[unitLen:])
+        }
+
+        return total, nil
+}
+
+// timeLayouts lists the absolute formats accepted by ParseTime. Layouts
+// without a zone are interpreted in local time.
+var timeLayouts = []string{
+        time.RFC3339Nano,
+        time.RFC3339,
+        "2006-01-02T15:04:05",
+        "2006-01-02T15:04",
+        "2006-01-02 15:04:05Z07:00",
+        "2006-01-02 15:04:05 -0700",
+        "2006-01-02 15:04:05 MST",
+        "2006-01-02 15:04:05",
+        "2006-01-02 15:04 -0700",
+        "2006-01-02 15:04 MST",
+        "2006-01-02 15:04",
+        "2006-01-02",
+        time.RFC1123Z,
+        time.RFC1123,
+}
+
+// ParseTime parses an absolute or relative point in time. It accepts
+// "now", "today", "yesterday", durations before now such as 7d or
+// "2w ago", dates (2006-01-02), and timestamps with or without a zone,
+// including RFC 3339.
+func ParseTime(s string, now time.Time) (time.Time, error) {
+        value := strings.TrimSpace(s)
+        midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+        switch strings.ToLower(value) {
+        case "now":
+                return now, nil
+        case "today":
+                return midnight, nil
+        case "yesterday":
+                return midnight.AddDate(0, 0, -1), nil
+        }
+
+        relative := strings.TrimSpace(strings.TrimSuffix(strings.ToLower(value), "ago"))
+        if d, err := ParseDuration(relative); err == nil {
+                return now.Add(-d), nil
+        }
+
+        for _, layout := range timeLayouts {
+                if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+                        return t, nil
+                }
+        }
+
+        return time.Time{}, fmt.Errorf("invalid time %q (expected e.g. 2006-01-02, 2006-01-02T15:04:05Z07:00, yesterday or 7d)", s)
+}
@@ -0,0 +1,107 @@
+package units
+
+import (
+        "testing"
+        "time"
+)
+
+func TestParseDuration(t *testing.T) {
+        tests := []struct {
+                in   string
+                want time.Duration
+        }{
+                {"90s", 90 * time.Second},
+                {"30m", 30 * time.Minute},
+                {"1.5h", 90 * time.Minute},
+                {"7d", 7 * day},
+                {"7D", 7 * day},
+                {"2w", 14 * day},
+                {"6mo", 180 * day},
+                {"1y", 365 * day},
+                {"1d12h", 36 * time.Hour},
+                {"1d 12h", 36 * time.Hour},
+                {"1mo1m", 30*day + time.Minute},
+                {" 3m ", 3 * time.Minute},
+        }
+
+        for _, tt := range tests {
+                got, err := ParseDuration(tt.in)
+                if err != nil {
+                        t.Errorf("ParseDuration(%q): unexpected error: %v", tt.in, err)
+                        continue
+                }
+                if got != tt.want {
+                        t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+                }
+        }
+}
+
+func TestParseDurationErrors(t *testing.T) {
+        for _, in := range []string{"", "7", "d", "7x", "7 days", "1d-2h", "-1d", "1.2.3h", "m0"} {
+                if got, err := ParseDuration(in); err == nil {
+                        t.Errorf("ParseDuration(%q) = %v, want an error", in, got)
+                }
+        }
+}
+
+func TestParseTime(t *testing.T) {
+        zone := time.FixedZone("CEST", 2*60*60)
+        now := time.Date(2024, 3, 15, 13, 45, 30, 0, zone)
+
+        tests := []struct {
+                in   string
+                want time.Time
+        }{
+                {"now", now},
+                {"NOW", now},
+                {"today", time.Date(2024, 3, 15, 0, 0, 0, 0, zone)},
+                {"yesterday", time.Date(2024, 3, 14, 0, 0, 0, 0, zone)},
+
+                // Relative times count back from now; m is minutes, mo months
+                {"7d", now.Add(-7 * day)},
+                {"2w ago", now.Add(-14 * day)},
+                {"3m ago", now.Add(-3 * time.Minute)},
+                {"3mo ago", now.Add(-90 * day)},
+                {"1d12h ago", now.Add(-36 * time.Hour)},
+                {"1y AGO", now.Add(-365 * day)},
+
+                // Layouts without a zone are in now's location
+                {"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, zone)},
+                {"2024-01-02T03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, zone)},
+                {"2024-01-02T03:04", time.Date(2024, 1, 2, 3, 4, 0, 0, zone)},
+                {"2024-01-02 03:04:05", time.Date(2024, 1, 2, 3, 4, 5, 0, zone)},
+                {"2024-01-02 03:04", time.Date(2024, 1, 2, 3, 4, 0, 0, zone)},
+
+                // Layouts with a zone
+                {"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+                {"2024-01-02T03:04:05.25+05:30", time.Date(2024, 1, 2, 3, 4, 5, 250e6, time.FixedZone("", 5*60*60+30*60))},
+                {"2024-01-02 03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+                {"2024-01-02 03:04:05-07:00", time.Date(2024, 1, 2, 10, 4, 5, 0, time.UTC)},
+                {"2024-01-02 03:04:05 -0700", time.Date(2024, 1, 2, 10, 4, 5, 0, time.UTC)},
+                {"2024-01-02 03:04:05 UTC", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+                {"2024-01-02 03:04 +0100", time.Date(2024, 1, 2, 2, 4, 0, 0, time.UTC)},
+                {"2024-01-02 03:04 UTC", time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)},
+                {"Tue, 02 Jan 2024 03:04:05 -0700", time.Date(2024, 1, 2, 10, 4, 5, 0, time.UTC)},
+                {"Tue, 02 Jan 2024 03:04:05 UTC", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+        }
+
+        for _, tt := range tests {
+                got, err := ParseTime(tt.in, now)
+                if err != nil {
+                        t.Errorf("ParseTime(%q): unexpected error: %v", tt.in, err)
+                        continue
+                }
+                if !got.Equal(tt.want) {
+                        t.Errorf("ParseTime(%q) = %v, want %v", tt.in, got, tt.want)
+                }
+        }
+}
+
+func TestParseTimeErrors(t *testing.T) {
+        now := time.Date(2024, 3, 15, 13, 45, 30, 0, time.UTC)
+        for _, in := range []string{"", "ago", "tomorrow", "7 days ago", "2024-13-01", "2024-02-30", "01/02/2024", "2024-01-02T25:00"} {
+                if got, err := ParseTime(in, now); err == nil {
+                        t.Errorf("ParseTime(%q) = %v, want an error", in, got)
+                }
+        }
+}